@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// writeArrow writes the results as an Apache Arrow IPC stream of a single record batch, with a row per station in
+// the same order as the results and the typed columns of statColumns, so polars or pyarrow load it without parsing
+func writeArrow(w io.Writer, results []*brc.StationResult, aggregations []string) error {
+	columns := statColumns(results, aggregations)
+	fields := []arrow.Field{{Name: "station", Type: arrow.BinaryTypes.String}}
+	for _, c := range columns {
+		field := arrow.Field{Name: c.name, Type: arrow.PrimitiveTypes.Float64, Nullable: true}
+		if c.integer {
+			field.Type = arrow.PrimitiveTypes.Int64
+		}
+		fields = append(fields, field)
+	}
+	schema := arrow.NewSchema(fields, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	for _, r := range results {
+		builder.Field(0).(*array.StringBuilder).Append(r.Station)
+		for i, v := range statValues(r, aggregations) {
+			switch v := v.(type) {
+			case float64:
+				builder.Field(i + 1).(*array.Float64Builder).Append(v)
+			case int:
+				builder.Field(i + 1).(*array.Int64Builder).Append(int64(v))
+			default:
+				builder.Field(i + 1).AppendNull()
+			}
+		}
+	}
+	record := builder.NewRecord()
+	defer record.Release()
+
+	writer := ipc.NewWriter(w, ipc.WithSchema(schema))
+	err := writer.Write(record)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+type BenchFlags struct {
+	File          string
+	Runs          int
+	IO            string
+	Parser        string
+	Workers       int
+	IOConcurrency int
+	MergeStrategy brc.MergeStrategy
+	Hash          bool
+}
+
+func parseBenchFlags(args []string) (BenchFlags, error) {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	file := fs.String("file", "", "specify the file to process")
+	runs := fs.Int("runs", 5, "number of measured runs, on top of the discarded warm-up run")
+	ioMode := fs.String("io", "scanner", "how the file is read: scanner or mmap")
+	parser := fs.String("parser", "fixed", "how readings are parsed: fixed or float")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of chunks the file is split into and read in parallel")
+	ioConcurrency := fs.Int("io-concurrency", 0, "maximum number of reads in flight at once, 0 is no limit")
+	mergeStrategy := fs.String("merge-strategy", "private", "how the stations of the workers are combined: private or sharded")
+	hash := fs.Bool("hash", false, "report the collisions of the station hash on the weather station names instead of processing a file")
+	err := fs.Parse(args)
+	if err != nil {
+		return BenchFlags{}, err
+	}
+
+	if *file == "" && !*hash {
+		return BenchFlags{}, errors.New("no file specified")
+	}
+	if *ioMode != "scanner" && *ioMode != "mmap" {
+		return BenchFlags{}, fmt.Errorf("unknown io %q", *ioMode)
+	}
+	if *parser != "fixed" && *parser != "float" {
+		return BenchFlags{}, fmt.Errorf("unknown parser %q", *parser)
+	}
+	if *runs < 1 {
+		return BenchFlags{}, errors.New("-runs must be at least 1")
+	}
+	if *workers < 1 {
+		return BenchFlags{}, errors.New("-workers must be at least 1")
+	}
+	if *ioConcurrency < 0 {
+		return BenchFlags{}, errors.New("-io-concurrency can't be negative")
+	}
+
+	strategy, err := parseMergeStrategy(*mergeStrategy)
+	if err != nil {
+		return BenchFlags{}, err
+	}
+
+	return BenchFlags{*file, *runs, *ioMode, *parser, *workers, *ioConcurrency, strategy, *hash}, nil
+}
+
+// runBench processes the file several times, from reading to formatting the output, and reports the wall time
+// and throughput of every run. The first run only warms up the page cache and is not counted.
+func runBench(args []string) error {
+	flags, err := parseBenchFlags(args)
+	if err != nil {
+		return err
+	}
+	if flags.Hash {
+		benchHashes()
+		return nil
+	}
+
+	opts := brc.Options{Mmap: flags.IO == "mmap", Workers: flags.Workers, IOConcurrency: flags.IOConcurrency, MergeStrategy: flags.MergeStrategy}
+	if flags.Parser == "float" {
+		opts.Parser = brc.ParseFloat
+	}
+
+	durations := make([]time.Duration, 0, flags.Runs)
+	for run := 0; run <= flags.Runs; run++ {
+		elapsed, rows, err := benchRun(flags.File, opts)
+		if err != nil {
+			return err
+		}
+
+		if run == 0 {
+			log.Println("warm-up run", elapsed)
+			continue
+		}
+		log.Printf("run %d: %v, %.0f rows/sec\n", run, elapsed, float64(rows)/elapsed.Seconds())
+		durations = append(durations, elapsed)
+	}
+
+	fastest, slowest, total := durations[0], durations[0], time.Duration(0)
+	for _, d := range durations {
+		fastest = min(fastest, d)
+		slowest = max(slowest, d)
+		total += d
+	}
+	fmt.Printf("runs: %d\nmin: %v\nmean: %v\nmax: %v\n", len(durations), fastest, total/time.Duration(len(durations)), slowest)
+
+	return nil
+}
+
+func benchRun(filepath string, opts brc.Options) (time.Duration, int, error) {
+	start := time.Now()
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("opening file for reading failed: %w", err)
+	}
+	defer file.Close()
+
+	results, err := brc.ProcessInputs([]io.Reader{file}, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	results.Sort()
+	err = writeResults(io.Discard, results.Rounded().Stations, false, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rows := 0
+	for _, s := range results.Stations {
+		rows += s.Readings
+	}
+
+	return time.Since(start), rows, nil
+}
+
+// benchHashes reports how the station hash spreads the weather station names, next to maphash for reference: the
+// names of which the full 64-bit hashes collide, and the probe lengths in a station table holding all of them
+func benchHashes() {
+	seed := maphash.MakeSeed()
+	hashes := []struct {
+		name string
+		hash func([]byte) uint64
+	}{
+		{"fnv-1a", brc.StationHash},
+		{"maphash", func(b []byte) uint64 { return maphash.Bytes(seed, b) }},
+	}
+
+	for _, h := range hashes {
+		collisions, meanProbe, maxProbe := hashCollisions(h.hash)
+		fmt.Printf("%s: %d stations, %d collisions, mean probe length %.3f, max probe length %d\n",
+			h.name, len(weatherStations), collisions, meanProbe, maxProbe)
+	}
+}
+
+// hashCollisions inserts the weather station names into linearly probed slots sized like a station table, at most
+// half full, and returns the number of full hash collisions with the mean and max number of slots probed per name
+func hashCollisions(hash func([]byte) uint64) (int, float64, int) {
+	size := 1024
+	for size < len(weatherStations)*2 {
+		size <<= 1
+	}
+	slots := make([]bool, size)
+	mask := uint64(size - 1)
+
+	seen := make(map[uint64]bool, len(weatherStations))
+	collisions, probes, maxProbe := 0, 0, 0
+	for _, s := range weatherStations {
+		h := hash([]byte(s.Name))
+		if seen[h] {
+			collisions++
+		}
+		seen[h] = true
+
+		probe := 1
+		i := h & mask
+		for ; slots[i]; i = (i + 1) & mask {
+			probe++
+		}
+		slots[i] = true
+		probes += probe
+		maxProbe = max(maxProbe, probe)
+	}
+	return collisions, float64(probes) / float64(len(weatherStations)), maxProbe
+}
@@ -0,0 +1,560 @@
+package brc
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+type number interface {
+	int64 | float64
+}
+
+// aggregate reads all readings from the chunks and computes the result per station, in the order they were first seen
+// The chunks are read in parallel, except for sorted input which is always a single chunk.
+// The parsed readings are divided by scale to get the actual values. It also returns the number of malformed lines skipped.
+func aggregate[T number](chunks []lineScanner, parse func([]byte) (T, bool), scale float64, opts Options) ([]*StationResult, int, error) {
+	extra := newExtraStats(opts, scale)
+	bad := newBadLines(len(chunks), opts)
+	start := time.Now()
+	opts.Timings.startChunks(len(chunks))
+	if opts.SortedInput {
+		stationsSlice := make([]*StationResult, 0, opts.ExpectedStations)
+		err := readSortedStations(chunks[0], opts.separator(), parse, extra, &bad[0], func(station string, v *stationAggregate[T]) {
+			if opts.Stations == nil || opts.Stations(station) {
+				stationsSlice = append(stationsSlice, v.result(station, scale))
+			}
+		})
+		opts.Timings.chunkRead(0, start, bad[0].lines)
+		opts.Timings.aggregated(start) // the stations are collected while reading, there is nothing to merge
+		if err != nil && !isContextErr(err) {
+			return nil, 0, err
+		}
+		skipped, lineErr := lineErr(bad)
+		if lineErr != nil {
+			return nil, 0, lineErr
+		}
+		setPercentiles(stationsSlice, opts.Percentiles)
+		return stationsSlice, skipped, err
+	}
+
+	if len(opts.Columns) > 1 {
+		chunkStations := make([]map[string][]stationAggregate[T], len(chunks))
+		chunkSeen := make([][]string, len(chunks))
+		readParallel(chunks, opts.Workers, func(i int, scanner lineScanner) {
+			chunkStart := time.Now()
+			table := newChunkTable[[]stationAggregate[T]](opts)
+			chunkStations[i], chunkSeen[i] = readColumnStations(scanner, opts.separator(), parse, len(opts.Columns), table, &bad[i])
+			recordTable(opts.MapStats, table)
+			opts.Timings.chunkRead(i, chunkStart, bad[i].lines)
+		})
+		start = opts.Timings.aggregated(start)
+		err := readErr(chunks)
+		if err != nil && !isContextErr(err) {
+			return nil, 0, err
+		}
+		skipped, lineErr := lineErr(bad)
+		if lineErr != nil {
+			return nil, 0, lineErr
+		}
+
+		stations, seen := mergeStations(chunkStations, chunkSeen, func(a []stationAggregate[T], b []stationAggregate[T]) {
+			for c := range a {
+				a[c].merge(&b[c])
+			}
+		})
+		seen = filterStations(seen, opts.Stations)
+		stationsSlice := collectColumnResults(stations, seen, opts.Columns, scale)
+		opts.Timings.merged(start)
+		return stationsSlice, skipped, err
+	}
+
+	if opts.MergeStrategy == MergeSharded {
+		shards := newShardedTable[T](opts.ExpectedStations)
+		readParallel(chunks, opts.Workers, func(i int, scanner lineScanner) {
+			chunkStart := time.Now()
+			readShardedStations(scanner, opts.separator(), parse, extra, shards, &bad[i])
+			opts.Timings.chunkRead(i, chunkStart, bad[i].lines)
+		})
+		for i := range shards.shards {
+			recordTable(opts.MapStats, shards.shards[i].table)
+		}
+		start = opts.Timings.aggregated(start)
+		err := readErr(chunks)
+		if err != nil && !isContextErr(err) {
+			return nil, 0, err
+		}
+		skipped, lineErr := lineErr(bad)
+		if lineErr != nil {
+			return nil, 0, lineErr
+		}
+
+		stations, seen := shards.stations()
+		if rename := opts.rename(); rename != nil {
+			stations, seen = rewriteStations(stations, seen, rename)
+		}
+		seen = filterStations(seen, opts.Stations)
+
+		stationsSlice := collectResults(stations, seen, scale)
+		setPercentiles(stationsSlice, opts.Percentiles)
+		opts.Timings.merged(start)
+		return stationsSlice, skipped, err
+	}
+
+	chunkStations := make([]map[string]*stationAggregate[T], len(chunks))
+	chunkSeen := make([][]string, len(chunks))
+	spills := newSpillers[T](len(chunks), opts)
+	readParallel(chunks, opts.Workers, func(i int, scanner lineScanner) {
+		chunkStart := time.Now()
+		var spill *spiller[T]
+		if spills != nil {
+			spill = spills[i]
+		}
+		table := newChunkTable[stationAggregate[T]](opts)
+		if opts.ParseLine != nil {
+			chunkStations[i], chunkSeen[i] = readParsedStations(scanner, opts.ParseLine, extra, table, &bad[i], spill)
+		} else {
+			chunkStations[i], chunkSeen[i] = readStations(scanner, opts.separator(), parse, extra, table, &bad[i], spill)
+		}
+		recordTable(opts.MapStats, table)
+		opts.Timings.chunkRead(i, chunkStart, bad[i].lines)
+	})
+	start = opts.Timings.aggregated(start)
+	for _, s := range spills {
+		defer s.close()
+	}
+	err := readErr(chunks)
+	if err != nil && !isContextErr(err) {
+		return nil, 0, err
+	}
+	skipped, lineErr := lineErr(bad)
+	if lineErr != nil {
+		return nil, 0, lineErr
+	}
+
+	for _, s := range spills {
+		if s.err != nil {
+			return nil, 0, s.err
+		}
+	}
+	if slices.ContainsFunc(spills, (*spiller[T]).spilled) {
+		stationsSlice, spillErr := mergeSpills(chunkStations, spills, scale, opts)
+		if spillErr != nil {
+			return nil, 0, spillErr
+		}
+		opts.Timings.merged(start)
+		return stationsSlice, skipped, err
+	}
+
+	stations, seen := mergeStations(chunkStations, chunkSeen, (*stationAggregate[T]).merge)
+	if rename := opts.rename(); rename != nil {
+		stations, seen = rewriteStations(stations, seen, rename)
+	}
+	seen = filterStations(seen, opts.Stations)
+
+	stationsSlice := collectResults(stations, seen, scale)
+	setPercentiles(stationsSlice, opts.Percentiles)
+	opts.Timings.merged(start)
+	return stationsSlice, skipped, err
+}
+
+// extraStats selects the statistics kept on top of the min, max, sum and readings, which slow down the hot loop
+type extraStats struct {
+	squares   bool               // sum the squares of the readings for the standard deviation
+	sketch    bool               // count the readings in a sketch for the percentiles
+	histogram bool               // count the readings in the histogram buckets
+	scale     float64            // the parsed readings are divided by to get the actual values
+	custom    []CustomAggregator // custom aggregators of every station
+}
+
+func newExtraStats(opts Options, scale float64) extraStats {
+	return extraStats{squares: opts.StdDev, sketch: len(opts.Percentiles) > 0, histogram: opts.Histogram, scale: scale, custom: opts.Aggregators}
+}
+
+func (e extraStats) any() bool {
+	return e.squares || e.sketch || e.histogram || e.custom != nil
+}
+
+// addExtra adds the reading to the extra statistics of v
+func addExtra[T number](v *stationAggregate[T], reading T, extra extraStats) {
+	if extra.squares {
+		v.SumSquares += float64(reading) * float64(reading)
+	}
+	if extra.sketch {
+		if v.Sketch == nil {
+			v.Sketch = &Sketch{}
+		}
+		v.Sketch.Add(float64(reading))
+	}
+	if extra.histogram {
+		if v.Histogram == nil {
+			v.Histogram = make([]uint64, HistogramBuckets)
+		}
+		v.Histogram[histogramBucket(float64(reading)/extra.scale)]++
+	}
+	if extra.custom != nil {
+		observeCustom(v, reading, extra)
+	}
+}
+
+// stationAggregate holds the running aggregation of a single station, T being the type the readings are parsed into
+type stationAggregate[T number] struct {
+	Min      T
+	Max      T
+	Sum      T
+	Readings int
+	// sum of the squared readings, only kept for the standard deviation. It is a float64 so it can't overflow,
+	// the squares of tenths stay exact up to 2^53.
+	SumSquares float64
+	Sketch     *Sketch           // only kept for the percentiles
+	Histogram  []uint64          // only kept for the histogram
+	Custom     []namedAggregator // only kept for Options.Aggregators
+}
+
+// readStations aggregates every line of the scanner per station into table, it also returns the stations in the order they were first encountered.
+// It stops at the first malformed line when bad says so, lines of stations the table can't hold are malformed.
+func readStations[T number](scanner lineScanner, sep byte, parse func([]byte) (T, bool), extra extraStats, table *stationTable[stationAggregate[T]], bad *badLines, spill *spiller[T]) (map[string]*stationAggregate[T], []string) {
+	for scanner.Scan() {
+		bad.lines++
+		token := scanner.Bytes()
+		i, hash := indexByteHash(token, sep)
+
+		if i < 0 {
+			if len(token) > 0 && !bad.malformed(token, "missing separator") {
+				break
+			}
+			continue
+		}
+
+		reading, ok := parse(token[i+1:])
+		if !ok {
+			if !bad.malformed(token, "invalid reading") {
+				break
+			}
+			continue
+		}
+		v, inserted := table.getHash(token[:i], hash)
+		if v == nil {
+			if !bad.malformed(token, "unknown station") {
+				break
+			}
+			continue
+		}
+		if inserted {
+			*v = stationAggregate[T]{Min: reading, Max: reading, Sum: reading, Readings: 1}
+		} else {
+			if v.Min > reading {
+				v.Min = reading
+			} else if v.Max < reading {
+				v.Max = reading
+			}
+			v.Sum += reading
+			v.Readings += 1
+		}
+		if extra.any() {
+			addExtra(v, reading, extra)
+		}
+		if inserted && spill != nil && len(table.entries) >= spill.threshold {
+			spill.spill(table)
+		}
+	}
+	if spill != nil && spill.spilled() {
+		// the rest is spilled too, the partitions are merged from the spill files
+		spill.spill(table)
+	}
+
+	stations := make(map[string]*stationAggregate[T], len(table.entries))
+	seen := make([]string, 0, len(table.entries))
+	for i := range table.entries {
+		e := &table.entries[i]
+		stations[e.key] = &e.value
+		seen = append(seen, e.key)
+	}
+
+	return stations, seen
+}
+
+// readColumnStations aggregates lines with multiple value columns into table, every column is aggregated separately
+func readColumnStations[T number](scanner lineScanner, sep byte, parse func([]byte) (T, bool), columns int, table *stationTable[[]stationAggregate[T]], bad *badLines) (map[string][]stationAggregate[T], []string) {
+	readings := make([]T, columns)
+lines:
+	for scanner.Scan() {
+		bad.lines++
+		token := scanner.Bytes()
+		i := indexByte(token, sep)
+
+		if i < 0 {
+			if len(token) > 0 && !bad.malformed(token, "missing separator") {
+				break
+			}
+			continue
+		}
+
+		values := token[i+1:]
+		for c := range readings {
+			end := indexByte(values, sep)
+			if end < 0 {
+				end = len(values)
+				if c < columns-1 {
+					if !bad.malformed(token, fmt.Sprintf("expected %d values, got %d", columns, c+1)) {
+						break lines
+					}
+					continue lines
+				}
+			} else if c == columns-1 {
+				// a value after the last column is as likely a misaligned line as the values before it
+				if !bad.malformed(token, fmt.Sprintf("expected %d values, got more", columns)) {
+					break lines
+				}
+				continue lines
+			}
+
+			reading, ok := parse(values[:end])
+			if !ok {
+				if !bad.malformed(token, "invalid reading") {
+					break lines
+				}
+				continue lines
+			}
+			readings[c] = reading
+			values = values[min(end+1, len(values)):]
+		}
+
+		entry, inserted := table.get(token[:i])
+		if entry == nil {
+			if !bad.malformed(token, "unknown station") {
+				break
+			}
+			continue
+		}
+		if inserted {
+			*entry = make([]stationAggregate[T], columns)
+			for c, reading := range readings {
+				(*entry)[c] = stationAggregate[T]{Min: reading, Max: reading, Sum: reading, Readings: 1}
+			}
+			continue
+		}
+
+		v := *entry
+		for c, reading := range readings {
+			if v[c].Min > reading {
+				v[c].Min = reading
+			} else if v[c].Max < reading {
+				v[c].Max = reading
+			}
+			v[c].Sum += reading
+			v[c].Readings += 1
+		}
+	}
+
+	stations := make(map[string][]stationAggregate[T], len(table.entries))
+	seen := make([]string, 0, len(table.entries))
+	for _, e := range table.entries {
+		stations[e.key] = e.value
+		seen = append(seen, e.key)
+	}
+
+	return stations, seen
+}
+
+// readSortedStations aggregates a scanner whose lines are sorted by station name without keeping a map of all stations,
+// every station is passed to flush as soon as the next one appears. It errors as soon as the input turns out not to be sorted.
+func readSortedStations[T number](scanner lineScanner, sep byte, parse func([]byte) (T, bool), extra extraStats, bad *badLines, flush func(string, *stationAggregate[T])) error {
+	var current string
+	var v *stationAggregate[T]
+	for scanner.Scan() {
+		bad.lines++
+		token := scanner.Bytes()
+		i := indexByte(token, sep)
+
+		if i < 0 {
+			if len(token) > 0 && !bad.malformed(token, "missing separator") {
+				return nil
+			}
+			continue
+		}
+
+		reading, ok := parse(token[i+1:])
+		if !ok {
+			if !bad.malformed(token, "invalid reading") {
+				return nil
+			}
+			continue
+		}
+
+		if v != nil && string(token[:i]) == current {
+			if v.Min > reading {
+				v.Min = reading
+			} else if v.Max < reading {
+				v.Max = reading
+			}
+			v.Sum += reading
+			v.Readings += 1
+			if extra.any() {
+				addExtra(v, reading, extra)
+			}
+			continue
+		}
+
+		if v != nil {
+			if string(token[:i]) < current {
+				return fmt.Errorf("input is not sorted, station %q on line %d comes after %q", token[:i], bad.lines, current)
+			}
+			flush(current, v)
+		}
+
+		current = string(token[:i])
+		v = &stationAggregate[T]{Min: reading, Max: reading, Sum: reading, Readings: 1}
+		if extra.any() {
+			addExtra(v, reading, extra)
+		}
+	}
+
+	if v != nil {
+		flush(current, v)
+	}
+
+	return scanner.Err()
+}
+
+func (a *stationAggregate[T]) merge(other *stationAggregate[T]) {
+	a.Min = min(a.Min, other.Min)
+	a.Max = max(a.Max, other.Max)
+	a.Sum += other.Sum
+	a.Readings += other.Readings
+	a.SumSquares += other.SumSquares
+	if a.Sketch != nil && other.Sketch != nil {
+		a.Sketch.Merge(other.Sketch)
+	}
+	mergeHistograms(a.Histogram, other.Histogram)
+	mergeCustom(a.Custom, other.Custom)
+}
+
+// mergeStations merges the aggregates of all chunks into the first chunk. When the chunks are in file order
+// the merged stations are still in the order they were first seen in.
+func mergeStations[V any](chunkStations []map[string]V, chunkSeen [][]string, merge func(V, V)) (map[string]V, []string) {
+	stations, seen := chunkStations[0], chunkSeen[0]
+	for i := 1; i < len(chunkStations); i++ {
+		for _, s := range chunkSeen[i] {
+			v, ok := stations[s]
+			if !ok {
+				stations[s] = chunkStations[i][s]
+				seen = append(seen, s)
+				continue
+			}
+
+			merge(v, chunkStations[i][s])
+		}
+	}
+
+	return stations, seen
+}
+
+// filterStations returns the stations for which keep returns true, or all of them when keep is nil. This runs once
+// per distinct station, leaving the hot loop alone.
+func filterStations(seen []string, keep func(string) bool) []string {
+	if keep == nil {
+		return seen
+	}
+	return slices.DeleteFunc(seen, func(s string) bool { return !keep(s) })
+}
+
+// rewriteStations renames the aggregated stations and merges the ones that end up with the same name.
+// This runs once per distinct station rather than once per line, so renaming doesn't slow down the hot loop.
+func rewriteStations[T number](stations map[string]*stationAggregate[T], seen []string, rename func(string) string) (map[string]*stationAggregate[T], []string) {
+	rewritten := make(map[string]*stationAggregate[T], len(stations))
+	rewrittenSeen := make([]string, 0, len(seen))
+	for _, s := range seen {
+		name := rename(s)
+		v, ok := rewritten[name]
+		if !ok {
+			rewritten[name] = stations[s]
+			rewrittenSeen = append(rewrittenSeen, name)
+			continue
+		}
+
+		v.merge(stations[s])
+	}
+
+	return rewritten, rewrittenSeen
+}
+
+func collectResults[T number](stations map[string]*stationAggregate[T], seen []string, scale float64) []*StationResult {
+	stationsSlice := make([]*StationResult, 0, len(seen))
+	for _, s := range seen {
+		stationsSlice = append(stationsSlice, stations[s].result(s, scale))
+	}
+
+	return stationsSlice
+}
+
+// collectColumnResults converts the multi column aggregates to results, the first value column is also used for the
+// top level min/max/mean of the result
+func collectColumnResults[T number](stations map[string][]stationAggregate[T], seen []string, columns []string, scale float64) []*StationResult {
+	stationsSlice := make([]*StationResult, 0, len(seen))
+	for _, s := range seen {
+		v := stations[s]
+		result := v[0].result(s, scale)
+		result.Columns = make([]ColumnResult, len(v))
+		for c := range v {
+			r := v[c].result(s, scale)
+			result.Columns[c] = ColumnResult{columns[c], r.Min, r.Max, r.Mean, r.Sum}
+		}
+		stationsSlice = append(stationsSlice, result)
+	}
+
+	return stationsSlice
+}
+
+func (a *stationAggregate[T]) result(station string, scale float64) *StationResult {
+	min := float64(a.Min) / scale
+	max := float64(a.Max) / scale
+	mean := float64(a.Sum) / (scale * float64(a.Readings))
+	sum := float64(a.Sum) / scale
+	sumSquares := a.SumSquares / (scale * scale)
+
+	var sketch *Sketch
+	if a.Sketch != nil {
+		sketch = a.Sketch.scaled(scale)
+	}
+
+	return &StationResult{
+		Station:     station,
+		Min:         min,
+		Max:         max,
+		Mean:        mean,
+		Readings:    a.Readings,
+		Sum:         sum,
+		SumSquares:  sumSquares,
+		StdDev:      stdDev(sum, sumSquares, a.Readings),
+		Sketch:      sketch,
+		Histogram:   a.Histogram,
+		Aggregators: customResults(a.Custom),
+	}
+}
+
+// setPercentiles estimates the quantiles of every station from its sketch
+func setPercentiles(results []*StationResult, quantiles []float64) {
+	if len(quantiles) == 0 {
+		return
+	}
+
+	for _, r := range results {
+		r.Percentiles = make([]Percentile, len(quantiles))
+		for i, q := range quantiles {
+			r.Percentiles[i] = Percentile{q, 0}
+		}
+		r.estimatePercentiles()
+	}
+}
+
+// stdDev returns the population standard deviation of n readings from their sum and sum of squares, 0 when the
+// squares weren't summed
+func stdDev(sum float64, sumSquares float64, n int) float64 {
+	if sumSquares == 0 {
+		return 0
+	}
+	mean := sum / float64(n)
+	return math.Sqrt(max(sumSquares/float64(n)-mean*mean, 0))
+}
@@ -0,0 +1,63 @@
+package brc
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSortedInput(t *testing.T) {
+	input := "Abha;1.0\nAbha;3.0\nBerlin;-2.0\nCairo;20.0\nCairo;22.5\n"
+
+	path := filepath.Join(t.TempDir(), "sorted.txt")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// the chunks of a file are read one after the other, so a station can span chunks
+	fileResults, err := ProcessInputs([]io.Reader{file}, Options{SortedInput: true, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := ProcessInputs([]io.Reader{strings.NewReader(input)}, Options{SortedInput: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []StationResult{
+		{Station: "Abha", Min: 1, Max: 3, Mean: 2, Readings: 2, Sum: 4},
+		{Station: "Berlin", Min: -2, Max: -2, Mean: -2, Readings: 1, Sum: -2},
+		{Station: "Cairo", Min: 20, Max: 22.5, Mean: 21.25, Readings: 2, Sum: 42.5},
+	}
+	for _, stations := range [][]*StationResult{results.Stations, fileResults.Stations} {
+		if len(stations) != len(want) {
+			t.Fatalf("expected %d stations, got %d", len(want), len(stations))
+		}
+		for i, s := range stations {
+			w := want[i]
+			if s.Station != w.Station || s.Min != w.Min || s.Max != w.Max || s.Mean != w.Mean || s.Readings != w.Readings || s.Sum != w.Sum {
+				t.Errorf("expected %+v, got %+v", w, *s)
+			}
+		}
+	}
+}
+
+func TestSortedInputUnsorted(t *testing.T) {
+	input := "Abha;1.0\nCairo;20.0\nBerlin;-2.0\n"
+
+	_, err := ProcessInputs([]io.Reader{strings.NewReader(input)}, Options{SortedInput: true})
+	if err == nil {
+		t.Fatal("expected an error for unsorted input")
+	}
+	want := `input is not sorted, station "Berlin" on line 3 comes after "Cairo"`
+	if err.Error() != want {
+		t.Errorf("expected the error %q, got %q", want, err)
+	}
+}
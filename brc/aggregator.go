@@ -0,0 +1,77 @@
+package brc
+
+import "math"
+
+// Aggregator is a custom statistic of the readings of a station, like the number of readings below freezing,
+// computed in the hot loop next to the built-in ones. Every station of every chunk gets its own Aggregator, which
+// are merged like the built-in statistics once the chunks are read.
+type Aggregator interface {
+	Observe(tempTenths int) // adds a reading in tenths of a degree, rounded for readings with more decimals
+	Merge(other Aggregator) // adds the readings of other, an Aggregator of the same CustomAggregator
+	Result() any            // the statistic of the readings observed and merged so far
+}
+
+// CustomAggregator registers an Aggregator for a run under Name, New returns an empty one for every station
+type CustomAggregator struct {
+	Name string
+	New  func() Aggregator
+}
+
+// namedAggregator is an Aggregator of a station with the name it was registered under
+type namedAggregator struct {
+	name string
+	Aggregator
+}
+
+// observeCustom passes the reading to the custom aggregators of v, creating them for its first reading
+func observeCustom[T number](v *stationAggregate[T], reading T, extra extraStats) {
+	if v.Custom == nil {
+		v.Custom = make([]namedAggregator, len(extra.custom))
+		for i, c := range extra.custom {
+			v.Custom[i] = namedAggregator{c.Name, c.New()}
+		}
+	}
+
+	tenths := int(reading)
+	if extra.scale != 10 {
+		tenths = int(math.Round(float64(reading) * 10 / extra.scale))
+	}
+	for _, c := range v.Custom {
+		c.Observe(tenths)
+	}
+}
+
+// mergeCustom merges the custom aggregators of other into a, which were created for the same options in the same order
+func mergeCustom(a []namedAggregator, other []namedAggregator) {
+	for i := range min(len(a), len(other)) {
+		a[i].Merge(other[i].Aggregator)
+	}
+}
+
+// cloneCustom returns a copy of the custom aggregators of a station, created for aggregators, which later readings
+// and merges of custom don't change
+func cloneCustom(custom []namedAggregator, aggregators []CustomAggregator) []namedAggregator {
+	if custom == nil {
+		return nil
+	}
+
+	clone := make([]namedAggregator, len(custom))
+	for i, c := range aggregators[:len(custom)] {
+		clone[i] = namedAggregator{c.Name, c.New()}
+		clone[i].Merge(custom[i].Aggregator)
+	}
+	return clone
+}
+
+// customResults returns the custom aggregators by name, nil when there are none
+func customResults(custom []namedAggregator) map[string]Aggregator {
+	if custom == nil {
+		return nil
+	}
+
+	aggregators := make(map[string]Aggregator, len(custom))
+	for _, c := range custom {
+		aggregators[c.name] = c.Aggregator
+	}
+	return aggregators
+}
@@ -0,0 +1,489 @@
+// Package brc aggregates One Billion Row Challenge style measurements, lines in the form "station;reading",
+// into the min/mean/max reading per station.
+package brc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// DefaultBufferSize is the initial size of the read buffer of every chunk
+const DefaultBufferSize = 4096 * 4096
+
+// Parser selects how the readings are parsed
+type Parser int
+
+const (
+	ParseFixed Parser = iota // decimals with at most one fractional digit, parsed into exact integer tenths
+	ParseFloat               // any decimal, parsed into a float64
+	ParseInt                 // plain integers
+)
+
+// MergeStrategy selects how the stations of the chunks read in parallel are combined
+type MergeStrategy int
+
+const (
+	MergePrivate MergeStrategy = iota // every chunk has its own station table, the tables are merged once all are read
+	MergeSharded                      // the chunks share a station table split into shards by hash, each behind its own lock
+)
+
+type Options struct {
+	Workers          int       // number of chunks a regular file is split into and read at once, defaults to runtime.NumCPU()
+	IOConcurrency    int       // maximum number of reads in flight at once over all chunks, defaults to no limit
+	Mmap             bool      // memory map regular files instead of reading them through a buffer (linux and macOS only)
+	BufferSize       int       // initial size of the read buffer, defaults to DefaultBufferSize
+	ExpectedStations int       // number of distinct stations expected, used to pre-size the station maps
+	Parser           Parser    // how the readings are parsed, defaults to ParseFixed
+	Separator        byte      // separates the station from the reading and the value columns, defaults to ';'
+	DecimalComma     bool      // the readings have a decimal comma instead of a point, like 12,3
+	SortedInput      bool      // the input is sorted by station name, aggregate it in a single pass without a map
+	Columns          []string  // names of the value columns, when there is more than one they are each aggregated separately
+	Rewrite          *Rewrite  // rewrite the station names before the results are collected
+	Progress         *Progress // counts the lines read while processing, when set
+	Timings          *Timings  // times the phases of processing, when set
+	MapStats         *MapStats // collects the health of the station tables, when set
+	Offset           int64     // only process the lines of regular files starting at or after this byte offset
+	Length           int64     // only process the lines starting within Length bytes from Offset, 0 reads to the end
+	StdDev           bool      // also compute the standard deviation of every station
+	Percentiles      []float64 // quantiles between 0 and 1 to estimate for every station, like 0.5 and 0.99
+	Histogram        bool      // count the readings of every station in 1 degree histogram buckets
+	SkipValues       bool      // only count the readings of every station without parsing them, the other statistics are 0
+	OnError          ErrorMode // what happens to malformed lines, defaults to ErrorsFatal
+	SpillStations    int       // spill the stations of a chunk to disk once it holds this many, the results are then sorted by name. 0 never spills
+	SpillDir         string    // directory of the spill files, defaults to the temporary directory
+
+	// MergeStrategy selects how the stations of the chunks are combined, defaults to MergePrivate. MergeSharded
+	// doesn't keep the order the stations were first seen in.
+	MergeStrategy MergeStrategy
+
+	// Aggregators are computed for every station on top of the built-in statistics, in StationResult.Aggregators
+	Aggregators []CustomAggregator
+
+	// ParseLine splits every line of text input into the station and the reading in tenths of a degree instead of the
+	// separator and Parser, for lines with extra columns like timestamps or sensor IDs. It returns false for a
+	// malformed line. The returned station may point into the line, which is only valid during the call.
+	ParseLine func(line []byte) (key []byte, value int, ok bool)
+
+	// Quoted station names may be enclosed in double quotes to contain the separator, like "St. John;s";12.3, with
+	// a quote within the name doubled. Names without quotes are read as usual. Only the fixed parser reads them.
+	Quoted bool
+
+	// VerifyParse compares the parser with strconv.ParseFloat on the reading of every line with VerifyReading, and
+	// stops at the first mismatch with its error. It is a debug mode for changing the parsers, and a lot slower.
+	VerifyParse bool
+
+	// Limit only processes the first Limit lines of the inputs, counting malformed lines, and reads them as a single
+	// chunk to know which lines come first. 0 processes all lines.
+	Limit int64
+
+	// Sample only aggregates about this fraction of the lines, like 0.01 for every hundredth, with approximate
+	// statistics and the counts of the sample. Regular files are read in evenly spread blocks of lines making up the
+	// fraction, skipping the rest of the file, other input is read in full and every 1/Sample-th line aggregated.
+	// 0 aggregates all lines.
+	Sample float64
+
+	// Range only aggregates the readings within it, like the plausible readings of a sensor, when set
+	Range *ReadingRange
+
+	// Normalize normalizes the station names before the results are collected and before Rewrite, merging the
+	// stations which end up with the same name
+	Normalize Normalization
+
+	// StationSet holds all stations of the input when they are known in advance, looking them up by its perfect hash
+	// instead of the hash tables. Lines of other stations are malformed.
+	StationSet *StationSet
+
+	// BadLine is called with every malformed line with ErrorsCollect, never concurrently. The line is only valid
+	// during the call.
+	BadLine func(line []byte)
+
+	// OnLine is called with the station and reading of every valid line of text input, for side aggregations
+	// without a second pass over the input. The station is the name as it is in the line, before a normalization or
+	// rewrite, and is only valid during the call: copy it to keep it. Readings outside of Range aren't passed.
+	// Chunks read in parallel call it concurrently from their goroutines, set Workers to 1 to call it from a single
+	// one in the order of the lines.
+	OnLine func(station []byte, reading float64)
+
+	// Stations selects the stations in the results, with a normalization or rewrite by their new name. Nil keeps all
+	// of them.
+	Stations func(station string) bool
+}
+
+func (o Options) separator() byte {
+	if o.Separator == 0 {
+		return ';'
+	}
+	return o.Separator
+}
+
+func (o Options) validate() error {
+	if o.Offset < 0 || o.Length < 0 {
+		return errors.New("offset and length can't be negative")
+	}
+	if o.Separator == '\n' || o.Separator == '\r' || o.Separator == '-' || o.Separator == '.' || o.Separator >= '0' && o.Separator <= '9' {
+		return fmt.Errorf("separator %q can't be told apart from the readings", o.Separator)
+	}
+	if o.DecimalComma && o.separator() == ',' {
+		return errors.New("a decimal comma can't be combined with a comma separator")
+	}
+	if o.SortedInput && o.Rewrite != nil {
+		return errors.New("rewrite can't be combined with sorted input")
+	}
+	if len(o.Columns) > 1 && (o.SortedInput || o.Rewrite != nil) {
+		return errors.New("multiple columns can't be combined with sorted input or rewrite")
+	}
+	if len(o.Columns) > 1 && (o.StdDev || len(o.Percentiles) > 0 || o.Histogram || o.Aggregators != nil) {
+		return errors.New("standard deviation, percentiles, histograms and custom aggregators can't be computed for multiple columns")
+	}
+	if o.Aggregators != nil && o.SpillStations > 0 {
+		return errors.New("custom aggregators can't be spilled")
+	}
+	if o.StationSet != nil && o.SortedInput {
+		return errors.New("a station set can't be combined with sorted input")
+	}
+	if o.MergeStrategy == MergeSharded && (len(o.Columns) > 1 || o.SpillStations > 0 || o.StationSet != nil) {
+		return errors.New("the sharded merge strategy can't be combined with multiple columns, spilling or a station set")
+	}
+	if o.ParseLine != nil && (o.SortedInput || len(o.Columns) > 1 || o.MergeStrategy == MergeSharded) {
+		return errors.New("a line parser can't be combined with sorted input, multiple columns or the sharded merge strategy")
+	}
+	if o.Quoted && (o.ParseLine != nil || o.Parser != ParseFixed || o.SortedInput || len(o.Columns) > 1 || o.MergeStrategy == MergeSharded) {
+		return errors.New("quoted names can't be combined with a line parser, a parser other than the fixed one, sorted input, multiple columns or the sharded merge strategy")
+	}
+	if o.Quoted && (o.VerifyParse || o.Range != nil) {
+		return errors.New("quoted names can't be combined with verifying the parser or a reading range")
+	}
+	if o.VerifyParse && (len(o.Columns) > 1 || o.ParseLine != nil) {
+		return errors.New("verifying the parser can't be combined with multiple columns or a line parser")
+	}
+	if o.Limit < 0 {
+		return errors.New("the limit can't be negative")
+	}
+	if o.Normalize != 0 && (o.SortedInput || len(o.Columns) > 1 || o.SpillStations > 0) {
+		return errors.New("normalizing station names can't be combined with sorted input, multiple columns or spilling")
+	}
+	if o.Range != nil && (len(o.Columns) > 1 || o.ParseLine != nil) {
+		return errors.New("a reading range can't be combined with multiple columns or a line parser")
+	}
+	if o.OnLine != nil && (len(o.Columns) > 1 || o.SkipValues) {
+		return errors.New("a line callback can't be combined with multiple columns or skipping the values")
+	}
+	if o.Range != nil && !(o.Range.Min <= o.Range.Max) {
+		return fmt.Errorf("reading range %v to %v is empty", o.Range.Min, o.Range.Max)
+	}
+	if !(o.Sample >= 0 && o.Sample <= 1) {
+		return fmt.Errorf("sample fraction %v is not between 0 and 1", o.Sample)
+	}
+	if o.SpillStations < 0 {
+		return errors.New("the spill threshold can't be negative")
+	}
+	if o.SpillStations > 0 && (o.SortedInput || len(o.Columns) > 1 || o.Rewrite != nil) {
+		return errors.New("spilling can't be combined with sorted input, multiple columns or rewrite")
+	}
+	for _, q := range o.Percentiles {
+		if q < 0 || q > 1 {
+			return fmt.Errorf("percentile quantile %v is not between 0 and 1", q)
+		}
+	}
+	return nil
+}
+
+// Rewrite is a regexp substitution applied to the station names, stations which end up with the same name are aggregated together
+type Rewrite struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// ParseRewrite parses a rewrite in the form 'pattern=>replacement'
+func ParseRewrite(s string) (*Rewrite, error) {
+	pattern, replacement, ok := strings.Cut(s, "=>")
+	if !ok {
+		return nil, fmt.Errorf("rewrite %q is not in the form 'pattern=>replacement'", s)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rewrite pattern: %w", err)
+	}
+
+	return &Rewrite{re, replacement}, nil
+}
+
+type StationResult struct {
+	Station  string
+	Min      float64
+	Max      float64
+	Mean     float64
+	Readings int
+	Sum      float64        // sum of the readings, so results of separate runs can be merged
+	Columns  []ColumnResult // one entry per value column, only set when aggregating multiple columns
+
+	// population standard deviation of the readings and the sum of their squares it is computed from, only set with
+	// Options.StdDev
+	StdDev     float64
+	SumSquares float64
+
+	Percentiles []Percentile // estimates of Options.Percentiles, in the same order
+	Sketch      *Sketch      // counts of the readings the percentiles are estimated from, only set with Options.Percentiles
+
+	// number of readings in every histogram bucket, bucket i counting the readings from HistogramMin+i up to
+	// HistogramMin+i+1. Only set with Options.Histogram.
+	Histogram []uint64
+
+	// the aggregators of Options.Aggregators by name, Result returns their statistic. Only set with Options.Aggregators.
+	Aggregators map[string]Aggregator
+}
+
+type Percentile struct {
+	Quantile float64 `json:"quantile"` // between 0 and 1
+	Value    float64 `json:"value"`
+}
+
+// estimatePercentiles sets the values of the percentiles from the sketch, they are kept within the min and max
+func (s *StationResult) estimatePercentiles() {
+	for i := range s.Percentiles {
+		p := &s.Percentiles[i]
+		p.Value = min(max(s.Sketch.Quantile(p.Quantile), s.Min), s.Max)
+	}
+}
+
+type ColumnResult struct {
+	Column string  `json:"column"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Sum    float64 `json:"sum"`
+}
+
+// Results holds the result of every station, in the order the stations were first seen in the input unless sorted.
+// Custom aggregators only encode with gob when their types are registered with gob.Register.
+type Results struct {
+	Stations []*StationResult
+	Skipped  int // number of malformed lines left out with ErrorsSkip or ErrorsCollect
+	Excluded int // number of readings left out for being outside of Options.Range
+}
+
+// Sort sorts the stations by name
+func (r Results) Sort() {
+	slices.SortFunc(r.Stations, func(a *StationResult, b *StationResult) int {
+		return strings.Compare(a.Station, b.Station)
+	})
+}
+
+// All iterates over the stations by name and result in their current order, without copying them
+func (r Results) All() iter.Seq2[string, *StationResult] {
+	return func(yield func(string, *StationResult) bool) {
+		for _, s := range r.Stations {
+			if !yield(s.Station, s) {
+				return
+			}
+		}
+	}
+}
+
+// Sorted sorts the stations by name in place like Sort, and iterates over them like All
+func (r Results) Sorted() iter.Seq2[string, *StationResult] {
+	r.Sort()
+	return r.All()
+}
+
+// Process aggregates all readings of r with the default options
+func Process(r io.Reader) (Results, error) {
+	return ProcessInputs([]io.Reader{r}, Options{})
+}
+
+// ProcessInputs aggregates the readings of all inputs together, as if they were a single input. Regular files are read
+// from the start and split into chunks which are read in parallel, any other reader is read as a single chunk.
+func ProcessInputs(inputs []io.Reader, opts Options) (Results, error) {
+	return ProcessInputsContext(context.Background(), inputs, opts)
+}
+
+// ProcessInputsContext is ProcessInputs stopping once ctx is done. The results aggregated up to that point are
+// returned together with the error of ctx, so they can still be used as partial results.
+func ProcessInputsContext(ctx context.Context, inputs []io.Reader, opts Options) (Results, error) {
+	err := opts.validate()
+	if err != nil {
+		return Results{}, err
+	}
+
+	// quoted names are split off by a line parser, keeping them out of the hot loop of the separator
+	if opts.Quoted && opts.DecimalComma {
+		opts.ParseLine = quotedLine(opts.separator(), parseTenthsComma)
+	} else if opts.Quoted {
+		opts.ParseLine = quotedLine(opts.separator(), parseTenths)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if opts.SortedInput || opts.Limit > 0 {
+		workers = 1 // sorted input is aggregated in a single pass, and the first lines are only known in one
+	}
+
+	bufSize := opts.BufferSize
+	if bufSize <= 0 {
+		bufSize = DefaultBufferSize
+	}
+
+	// a nil channel leaves the reads unlimited
+	var ioSem chan struct{}
+	if opts.IOConcurrency > 0 {
+		ioSem = make(chan struct{}, opts.IOConcurrency)
+	}
+
+	var chunks []lineScanner
+	for _, input := range inputs {
+		file, ok := input.(*os.File)
+		if ok {
+			info, err := file.Stat()
+			ok = err == nil && info.Mode().IsRegular()
+		}
+		if !ok && (opts.Offset > 0 || opts.Length > 0) {
+			return Results{}, errors.New("offset and length only apply to regular files")
+		}
+		if !ok && opts.Sample > 0 {
+			chunks = append(chunks, &sampleLines{lineScanner: newBlockLines(timeReads(skipBOM(input), opts.Timings), bufSize, ioSem), fraction: opts.Sample})
+			continue
+		}
+		if !ok {
+			chunks = append(chunks, newBlockLines(timeReads(skipBOM(input), opts.Timings), bufSize, ioSem))
+			continue
+		}
+
+		start, end, err := lineRange(file, opts.Offset, opts.Length)
+		if err != nil {
+			return Results{}, fmt.Errorf("finding the lines in range failed: %w", err)
+		}
+
+		var blocks [][2]int64
+		if opts.Sample > 0 {
+			blocks, err = sampleFile(file, start, end, opts.Sample)
+			if err != nil {
+				return Results{}, fmt.Errorf("sampling file failed: %w", err)
+			}
+		}
+
+		if opts.Mmap {
+			data, err := mmapFile(file)
+			if err != nil {
+				return Results{}, fmt.Errorf("memory mapping file failed: %w", err)
+			}
+			defer munmapFile(data)
+
+			if blocks != nil {
+				for _, group := range groupBlocks(blocks, workers) {
+					lines := make([]lineScanner, len(group))
+					for i, b := range group {
+						lines[i] = &byteLines{data: data[b[0]:b[1]]}
+					}
+					chunks = append(chunks, &concatLines{lines})
+				}
+				continue
+			}
+			for _, chunk := range splitBytes(data[start:end], workers) {
+				chunks = append(chunks, &byteLines{data: chunk})
+			}
+			continue
+		}
+
+		if blocks != nil {
+			for _, group := range groupBlocks(blocks, workers) {
+				sections := make([]io.Reader, len(group))
+				for i, b := range group {
+					sections[i] = io.NewSectionReader(file, b[0], b[1]-b[0])
+				}
+				chunks = append(chunks, newBlockLines(timeReads(io.MultiReader(sections...), opts.Timings), bufSize, ioSem))
+			}
+			continue
+		}
+
+		sections, err := splitFile(file, start, end, workers)
+		if err != nil {
+			return Results{}, fmt.Errorf("splitting file failed: %w", err)
+		}
+
+		for _, section := range sections {
+			chunks = append(chunks, newBlockLines(timeReads(section, opts.Timings), bufSize, ioSem))
+		}
+	}
+
+	if len(chunks) == 0 {
+		return Results{}, nil
+	}
+
+	if opts.Limit > 0 {
+		chunks = []lineScanner{&limitLines{lineScanner: &concatLines{chunks}, remaining: opts.Limit}}
+	}
+
+	if ctx.Done() != nil {
+		for i, chunk := range chunks {
+			chunks[i] = &contextLines{lineScanner: chunk, ctx: ctx}
+		}
+	}
+
+	if opts.Progress != nil {
+		for i, chunk := range chunks {
+			chunks[i] = &progressLines{lineScanner: chunk, progress: opts.Progress}
+		}
+	}
+
+	if opts.VerifyParse {
+		for i, chunk := range chunks {
+			chunks[i] = &verifyLines{lineScanner: chunk, opts: opts}
+		}
+	}
+
+	var ranges []*rangeLines
+	if opts.Range != nil {
+		for i, chunk := range chunks {
+			r := &rangeLines{lineScanner: chunk, opts: opts}
+			chunks[i] = r
+			ranges = append(ranges, r)
+		}
+	}
+
+	if opts.OnLine != nil {
+		for i, chunk := range chunks {
+			chunks[i] = &callbackLines{lineScanner: chunk, opts: opts}
+		}
+	}
+
+	if opts.SortedInput {
+		chunks = []lineScanner{&concatLines{chunks}}
+	}
+
+	opts.Workers = workers
+
+	var results Results
+	switch {
+	case opts.ParseLine != nil:
+		// the readings of the line parser are tenths, parseTenths only picks the type they are aggregated as
+		results.Stations, results.Skipped, err = aggregate(chunks, parseTenths, 10, opts)
+	case opts.SkipValues:
+		results.Stations, results.Skipped, err = aggregate(chunks, skipValue, 1, opts)
+	case opts.Parser == ParseFloat && opts.DecimalComma:
+		results.Stations, results.Skipped, err = aggregate(chunks, parseFloatComma, 1, opts)
+	case opts.Parser == ParseFloat:
+		results.Stations, results.Skipped, err = aggregate(chunks, parseFloat, 1, opts)
+	case opts.Parser == ParseInt:
+		results.Stations, results.Skipped, err = aggregate(chunks, parseInt, 1, opts)
+	case opts.DecimalComma:
+		results.Stations, results.Skipped, err = aggregate(chunks, parseTenthsComma, 10, opts)
+	default:
+		results.Stations, results.Skipped, err = aggregate(chunks, parseTenths, 10, opts)
+	}
+	for _, r := range ranges {
+		results.Excluded += r.excluded
+	}
+
+	return results, err
+}
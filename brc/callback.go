@@ -0,0 +1,35 @@
+package brc
+
+// callbackLines passes the station and reading of every valid line of its scanner to Options.OnLine before
+// returning the line, parsing the reading once more on top of the aggregation
+type callbackLines struct {
+	lineScanner
+	opts Options
+}
+
+func (c *callbackLines) Scan() bool {
+	if !c.lineScanner.Scan() {
+		return false
+	}
+
+	line := c.Bytes()
+	if len(line) == 0 {
+		return true
+	}
+	var station []byte
+	var reading float64
+	var ok bool
+	if c.opts.ParseLine != nil {
+		var tenths int
+		station, tenths, ok = c.opts.ParseLine(line)
+		reading = float64(tenths) / 10
+	} else if i := indexByte(line, c.opts.separator()); i >= 0 {
+		station = line[:i]
+		reading, ok = ParseReading(line[i+1:], c.opts)
+	}
+	// lines of stations outside of the station set are malformed
+	if ok && (c.opts.StationSet == nil || c.opts.StationSet.lookup(station, StationHash(station)) >= 0) {
+		c.opts.OnLine(station, reading)
+	}
+	return true
+}
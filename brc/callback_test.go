@@ -0,0 +1,97 @@
+package brc
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type reading struct {
+	station string
+	value   float64
+}
+
+func TestOnLine(t *testing.T) {
+	input := "Abha;1.0\nBerlin;-2.5\nbad line\nAbha;xx\n\nCairo;30.0\nAbha;4.5\n"
+
+	var got []reading
+	opts := Options{
+		OnError: ErrorsSkip,
+		OnLine: func(station []byte, value float64) {
+			got = append(got, reading{string(station), value})
+		},
+	}
+	results, err := ProcessInputs([]io.Reader{strings.NewReader(input)}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []reading{{"Abha", 1}, {"Berlin", -2.5}, {"Cairo", 30}, {"Abha", 4.5}}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected the readings %v, got %v", want, got)
+	}
+	if results.Skipped != 2 {
+		t.Errorf("expected 2 skipped lines, got %d", results.Skipped)
+	}
+}
+
+func TestOnLineRange(t *testing.T) {
+	input := "Abha;1.0\nBerlin;-2.5\nCairo;30.0\n"
+
+	var got []reading
+	opts := Options{
+		Range: &ReadingRange{0, 10},
+		OnLine: func(station []byte, value float64) {
+			got = append(got, reading{string(station), value})
+		},
+	}
+	_, err := ProcessInputs([]io.Reader{strings.NewReader(input)}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []reading{{"Abha", 1}}; !slices.Equal(got, want) {
+		t.Errorf("expected the readings %v, got %v", want, got)
+	}
+}
+
+func TestOnLineParallel(t *testing.T) {
+	var input strings.Builder
+	for i := range 10000 {
+		input.WriteString([]string{"Abha;1.0\n", "Berlin;-2.5\n", "Cairo;30.0\n"}[i%3])
+	}
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(path, []byte(input.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	opts := Options{
+		Workers: 4,
+		OnLine: func(station []byte, value float64) {
+			mu.Lock()
+			defer mu.Unlock()
+			counts[string(station)]++
+		},
+	}
+	results, err := ProcessInputs([]io.Reader{file}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range results.Stations {
+		if counts[s.Station] != s.Readings {
+			t.Errorf("expected %d readings of %s, the callback got %d", s.Readings, s.Station, counts[s.Station])
+		}
+	}
+}
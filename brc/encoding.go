@@ -0,0 +1,178 @@
+package brc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// stationJSON is the json encoding of a StationResult, it keeps everything needed to merge it again. The results of
+// custom aggregators are written but can't be read back.
+type stationJSON struct {
+	Station     string         `json:"station"`
+	Min         float64        `json:"min"`
+	Max         float64        `json:"max"`
+	Mean        float64        `json:"mean"`
+	Count       int            `json:"count"`
+	Sum         float64        `json:"sum"`
+	Columns     []ColumnResult `json:"columns,omitempty"`
+	StdDev      float64        `json:"stddev,omitempty"`
+	SumSquares  float64        `json:"sum_squares,omitempty"`
+	Percentiles []Percentile   `json:"percentiles,omitempty"`
+	Sketch      *Sketch        `json:"sketch,omitempty"`
+	Histogram   []uint64       `json:"histogram,omitempty"`
+	Aggregators map[string]any `json:"aggregators,omitempty"`
+}
+
+func (s *StationResult) MarshalJSON() ([]byte, error) {
+	station := stationJSON{
+		Station:     s.Station,
+		Min:         s.Min,
+		Max:         s.Max,
+		Mean:        s.Mean,
+		Count:       s.Readings,
+		Sum:         s.Sum,
+		Columns:     s.Columns,
+		StdDev:      s.StdDev,
+		SumSquares:  s.SumSquares,
+		Percentiles: s.Percentiles,
+		Sketch:      s.Sketch,
+		Histogram:   s.Histogram,
+	}
+	if s.Aggregators != nil {
+		station.Aggregators = make(map[string]any, len(s.Aggregators))
+		for name, a := range s.Aggregators {
+			station.Aggregators[name] = a.Result()
+		}
+	}
+	return json.Marshal(station)
+}
+
+func (s *StationResult) UnmarshalJSON(data []byte) error {
+	var station stationJSON
+	err := json.Unmarshal(data, &station)
+	if err != nil {
+		return err
+	}
+	if station.Histogram != nil && len(station.Histogram) != HistogramBuckets {
+		return fmt.Errorf("histogram of %s has %d buckets instead of %d", station.Station, len(station.Histogram), HistogramBuckets)
+	}
+
+	*s = StationResult{
+		Station:     station.Station,
+		Min:         station.Min,
+		Max:         station.Max,
+		Mean:        station.Mean,
+		Readings:    station.Count,
+		Sum:         station.Sum,
+		Columns:     station.Columns,
+		StdDev:      station.StdDev,
+		SumSquares:  station.SumSquares,
+		Percentiles: station.Percentiles,
+		Sketch:      station.Sketch,
+		Histogram:   station.Histogram,
+	}
+	return nil
+}
+
+// resultsJSON is the json and gob encoding of Results
+type resultsJSON struct {
+	Stations []*StationResult `json:"stations"`
+	Skipped  int              `json:"skipped"`
+	Excluded int              `json:"excluded,omitempty"`
+}
+
+// MarshalJSON encodes the results with everything needed to merge them again, unlike the json output format of the
+// command line which only has the selected statistics
+func (r Results) MarshalJSON() ([]byte, error) {
+	stations := r.Stations
+	if stations == nil {
+		stations = []*StationResult{}
+	}
+	return json.Marshal(resultsJSON{stations, r.Skipped, r.Excluded})
+}
+
+func (r *Results) UnmarshalJSON(data []byte) error {
+	var results resultsJSON
+	err := json.Unmarshal(data, &results)
+	if err != nil {
+		return err
+	}
+	*r = Results{results.Stations, results.Skipped, results.Excluded}
+	return nil
+}
+
+// GobEncode encodes the results with everything needed to merge them again. Without it gob would use MarshalText,
+// which only keeps the rounded min, mean and max.
+func (r Results) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(resultsJSON{r.Stations, r.Skipped, r.Excluded})
+	return buf.Bytes(), err
+}
+
+func (r *Results) GobDecode(data []byte) error {
+	var results resultsJSON
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&results)
+	if err != nil {
+		return err
+	}
+	*r = Results{results.Stations, results.Skipped, results.Excluded}
+	return nil
+}
+
+// MarshalText encodes the results in the output format of the challenge, {Abha=-23.0/18.0/59.2, ...}, with the
+// min, mean and max rounded to one decimal and the stations in their current order
+func (r Results) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, s := range r.Stations {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%s=%.1f/%.1f/%.1f", s.Station, Round(s.Min), Round(s.Mean), Round(s.Max))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText decodes results in the output format of the challenge. It only holds the min, mean and max of
+// every station, so the results can be compared but not merged.
+func (r *Results) UnmarshalText(text []byte) error {
+	text = bytes.TrimSpace(text)
+	inner, ok := bytes.CutPrefix(text, []byte("{"))
+	if ok {
+		inner, ok = bytes.CutSuffix(inner, []byte("}"))
+	}
+	if !ok {
+		return errors.New("results are not enclosed in braces")
+	}
+
+	*r = Results{}
+	if len(inner) == 0 {
+		return nil
+	}
+	for _, entry := range bytes.Split(inner, []byte(", ")) {
+		i := bytes.LastIndexByte(entry, '=')
+		if i < 0 {
+			return fmt.Errorf("station %q has no readings", entry)
+		}
+		readings := bytes.Split(entry[i+1:], []byte("/"))
+		if len(readings) != 3 {
+			return fmt.Errorf("station %q doesn't have a min, mean and max", entry[:i])
+		}
+
+		var values [3]float64
+		for v, reading := range readings {
+			value, err := strconv.ParseFloat(string(reading), 64)
+			if err != nil {
+				return fmt.Errorf("station %q has an invalid reading %q", entry[:i], reading)
+			}
+			values[v] = value
+		}
+		r.Stations = append(r.Stations, &StationResult{Station: string(entry[:i]), Min: values[0], Mean: values[1], Max: values[2]})
+	}
+	return nil
+}
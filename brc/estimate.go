@@ -0,0 +1,78 @@
+package brc
+
+import (
+	"errors"
+	"io"
+	"os"
+	"slices"
+)
+
+type FileEstimate struct {
+	Stations   int
+	LineLength int
+}
+
+const estimateSampleSize = 4 * 1024 * 1024
+
+// EstimateFile samples the start and the middle of the file to guess the number of distinct stations
+// and the mean line length. The file offset is reset to the start afterwards.
+func EstimateFile(file *os.File) (FileEstimate, error) {
+	return EstimateFileSeparator(file, ';')
+}
+
+// EstimateFileSeparator is EstimateFile for lines with another separator between the station and the reading
+func EstimateFileSeparator(file *os.File, separator byte) (FileEstimate, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return FileEstimate{}, err
+	}
+
+	offsets := []int64{0}
+	if info.Size() > 2*estimateSampleSize {
+		offsets = append(offsets, info.Size()/2)
+	}
+
+	names := map[string]struct{}{}
+	lines, bytes := 0, 0
+	buf := make([]byte, estimateSampleSize)
+	for _, offset := range offsets {
+		n, err := file.ReadAt(buf, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return FileEstimate{}, err
+		}
+		chunk := buf[:n]
+
+		// a chunk in the middle of the file most likely starts halfway through a line
+		if offset > 0 {
+			i := slices.Index(chunk, '\n')
+			if i < 0 {
+				continue
+			}
+			chunk = chunk[i+1:]
+		}
+
+		for len(chunk) > 0 {
+			end := slices.Index(chunk, '\n')
+			if end < 0 {
+				break // partial line at the end of the sample
+			}
+			line := chunk[:end]
+			chunk = chunk[end+1:]
+
+			lines++
+			bytes += len(line) + 1
+			if i := slices.Index(line, separator); i >= 0 {
+				names[string(line[:i])] = struct{}{}
+			}
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return FileEstimate{}, err
+	}
+
+	if lines == 0 {
+		return FileEstimate{}, nil
+	}
+	return FileEstimate{len(names), bytes / lines}, nil
+}
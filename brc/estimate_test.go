@@ -0,0 +1,73 @@
+package brc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeStations writes a file of rows random readings of stations stations with the separator, it returns the mean
+// line length
+func writeStations(t *testing.T, path string, stations int, rows int, separator byte) int {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	r := rand.New(rand.NewPCG(1, 2))
+	w := bufio.NewWriter(file)
+	bytes := 0
+	for range rows {
+		n, _ := fmt.Fprintf(w, "station-%d%c%.1f\n", r.IntN(stations), separator, r.Float64()*100-50)
+		bytes += n
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes / rows
+}
+
+func TestEstimateFileSeparator(t *testing.T) {
+	tests := []struct {
+		name      string
+		stations  int
+		rows      int
+		separator byte
+	}{
+		{"small file", 400, 100_000, ';'},
+		// larger than two samples, so it is sampled at the start and in the middle
+		{"sampled file", 10_000, 1_000_000, ';'},
+		{"comma", 400, 100_000, ','},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "measurements.txt")
+			lineLength := writeStations(t, path, tt.stations, tt.rows, tt.separator)
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			estimate, err := EstimateFileSeparator(file, tt.separator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if estimate.Stations < tt.stations/2 || estimate.Stations > tt.stations*2 {
+				t.Errorf("expected about %d stations, estimated %d", tt.stations, estimate.Stations)
+			}
+			if estimate.LineLength < lineLength-1 || estimate.LineLength > lineLength+1 {
+				t.Errorf("expected a line length of about %d, estimated %d", lineLength, estimate.LineLength)
+			}
+			if offset, _ := file.Seek(0, io.SeekCurrent); offset != 0 {
+				t.Errorf("expected the file offset to be reset to the start, got %d", offset)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package brc
+
+import (
+	"fmt"
+	"io"
+)
+
+// ProcessFunc calls fn with every reading of r in input order instead of aggregating them, with the reading in
+// tenths of a degree, so callers can filter, forward or aggregate the readings their own way. It uses the same
+// scanner and parser as Process, reading r as a single chunk. The station is only valid during the call.
+// It stops at the first malformed line with a *LineError, or at the first error of fn which is returned as is.
+func ProcessFunc(r io.Reader, fn func(station []byte, tempTenths int) error) error {
+	scanner := newBlockLines(skipBOM(r), DefaultBufferSize, nil)
+	line := 0
+	for scanner.Scan() {
+		line++
+		token := scanner.Bytes()
+		i := indexByte(token, ';')
+
+		if i < 0 {
+			if len(token) > 0 {
+				return &LineError{line, string(token), "missing separator"}
+			}
+			continue
+		}
+
+		reading, ok := parseTenths(token[i+1:])
+		if !ok {
+			return &LineError{line, string(token), "invalid reading"}
+		}
+		err := fn(token[:i], int(reading))
+		if err != nil {
+			return err
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("reading input failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package brc
+
+// The station tables hash the names with FNV-1a, which is simple enough to compute while scanning for the separator
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+// StationHash returns the hash the station tables use for a station name
+func StationHash(name []byte) uint64 {
+	h := uint64(fnvOffset)
+	for _, c := range name {
+		h ^= uint64(c)
+		h *= fnvPrime
+	}
+	return foldHash(h)
+}
+
+// foldHash folds the high bits of an FNV-1a hash into the low bits, which pick the slot of a station. The low bits
+// of FNV-1a only depend on the low bits of the bytes, so names differing in a high bit would otherwise collide.
+func foldHash(h uint64) uint64 {
+	return h ^ h>>32
+}
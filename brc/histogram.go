@@ -0,0 +1,25 @@
+package brc
+
+import "math"
+
+const (
+	HistogramMin     = -100 // lower bound of the first histogram bucket, lower readings are counted in it as well
+	HistogramMax     = 100  // upper bound of the last histogram bucket, higher readings are counted in it as well
+	HistogramBuckets = HistogramMax - HistogramMin
+)
+
+// histogramBucket returns the bucket of the reading, a bucket per degree
+func histogramBucket(reading float64) int {
+	bucket := int(math.Floor(reading)) - HistogramMin
+	return min(max(bucket, 0), HistogramBuckets-1)
+}
+
+// mergeHistograms adds the counts of other to h, either of which may be nil when there is no histogram
+func mergeHistograms(h []uint64, other []uint64) {
+	if h == nil || other == nil {
+		return
+	}
+	for i, c := range other {
+		h[i] += c
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !swar
+
+package brc
+
+import "slices"
+
+// indexByte returns the index of the first c in b, or -1. Build with -tags swar to scan 8 bytes at a time instead.
+func indexByte(b []byte, c byte) int {
+	return slices.Index(b, c)
+}
+
+// indexByteHash is indexByte that also returns the StationHash of the bytes before c, computed in the same pass
+func indexByteHash(b []byte, c byte) (int, uint64) {
+	h := uint64(fnvOffset)
+	for i, x := range b {
+		if x == c {
+			return i, foldHash(h)
+		}
+		h ^= uint64(x)
+		h *= fnvPrime
+	}
+	return -1, 0
+}
@@ -0,0 +1,45 @@
+//go:build swar
+
+package brc
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	swarOnes  = 0x0101010101010101
+	swarHighs = 0x8080808080808080
+)
+
+// indexByte returns the index of the first c in b, or -1. It compares 8 bytes at a time (SWAR): after xoring a word
+// with c in every byte the matching bytes are zero, and (x - 0x01..) &^ x & 0x80.. sets the high bit of the lowest
+// zero byte. Bytes above it can be false positives, but only the lowest one is used.
+func indexByte(b []byte, c byte) int {
+	pattern := swarOnes * uint64(c)
+	i := 0
+	for ; i+8 <= len(b); i += 8 {
+		x := binary.LittleEndian.Uint64(b[i:]) ^ pattern
+		found := (x - swarOnes) &^ x & swarHighs
+		if found != 0 {
+			return i + bits.TrailingZeros64(found)>>3
+		}
+	}
+
+	for ; i < len(b); i++ {
+		if b[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexByteHash is indexByte that also returns the StationHash of the bytes before c. Scanning 8 bytes at a time
+// beats hashing along the way, so the name is hashed once the separator is found.
+func indexByteHash(b []byte, c byte) (int, uint64) {
+	i := indexByte(b, c)
+	if i < 0 {
+		return -1, 0
+	}
+	return i, StationHash(b[:i])
+}
@@ -0,0 +1,95 @@
+package brc
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// The tests and benchmarks cover whichever indexByte the build has, compare the two with
+// go test -bench . against go test -bench . -tags swar
+
+// naiveIndexByte is the byte by byte reference for indexByte
+func naiveIndexByte(b []byte, c byte) int {
+	for i, x := range b {
+		if x == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestIndexByte(t *testing.T) {
+	// bytes around c and with the high bit set catch carries and false positives of the SWAR bit tricks
+	for _, c := range []byte{';', '\n', 0, 0x80, 0xff} {
+		fillers := []byte{c + 1, c - 1, c ^ 0x80, 0x80, 0xff, 0x01, 0}
+		buf := make([]byte, 64)
+		for _, filler := range fillers {
+			if filler == c {
+				continue
+			}
+			// every start offset within a word, every length up to a few words and every position of c or none
+			for offset := range 8 {
+				for n := range 40 {
+					for at := -1; at < n; at++ {
+						b := buf[offset : offset+n]
+						for i := range b {
+							b[i] = filler
+						}
+						if at >= 0 {
+							b[at] = c
+							// a second c after the first must not be found instead
+							if at+3 < n {
+								b[at+3] = c
+							}
+						}
+
+						if got, want := indexByte(b, c), naiveIndexByte(b, c); got != want {
+							t.Fatalf("indexByte(%q, %q) = %d, expected %d", b, c, got, want)
+						}
+						i, hash := indexByteHash(b, c)
+						if want := naiveIndexByte(b, c); i != want || i >= 0 && hash != StationHash(b[:i]) {
+							t.Fatalf("indexByteHash(%q, %q) = %d, %x, expected %d with the hash of the name", b, c, i, hash, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// benchmarkLines are lines like those of the challenge, with names of the typical lengths
+var benchmarkLines = func() [][]byte {
+	names := []string{"Abha", "Hamburg", "Las Palmas de Gran Canaria", "St. John's", "Yaoundé", "Petropavlovsk-Kamchatsky"}
+	var lines [][]byte
+	for i := range 1024 {
+		lines = append(lines, fmt.Appendf(nil, "%s;%.1f", names[i%len(names)], float64(i%1999-999)/10))
+	}
+	return lines
+}()
+
+func BenchmarkIndexByte(b *testing.B) {
+	for _, n := range []int{8, 32, 128, 1024} {
+		data := slices.Repeat([]byte{'x'}, n)
+		data[n-1] = '\n'
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.SetBytes(int64(n))
+			for b.Loop() {
+				indexByte(data, '\n')
+			}
+		})
+	}
+}
+
+func BenchmarkSeparator(b *testing.B) {
+	size := 0
+	for _, line := range benchmarkLines {
+		size += len(line)
+	}
+	b.SetBytes(int64(size))
+	for b.Loop() {
+		for _, line := range benchmarkLines {
+			indexByteHash(line, ';')
+		}
+	}
+}
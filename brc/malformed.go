@@ -0,0 +1,87 @@
+package brc
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ErrorMode selects what happens to malformed lines, lines without a separator or with a reading that fails to parse.
+// Empty lines are always ignored.
+type ErrorMode int
+
+const (
+	ErrorsFatal   ErrorMode = iota // stop at the first malformed line with a *LineError
+	ErrorsSkip                     // leave the malformed lines out and count them in Results.Skipped
+	ErrorsCollect                  // like ErrorsSkip, also passing every malformed line to Options.BadLine
+)
+
+// LineError is the error of a malformed line with ErrorsFatal
+type LineError struct {
+	Line   int // number of the line counting from 1, over all inputs together
+	Text   string
+	Reason string
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s: %q", e.Line, e.Reason, e.Text)
+}
+
+// badLines handles the malformed lines of a single chunk and counts its lines, so the line number of an error can be
+// found once the chunks before it are read
+type badLines struct {
+	mode    ErrorMode
+	collect func([]byte)
+	lines   int
+	skipped int
+	err     *LineError
+}
+
+// malformed handles the current line being malformed, it returns false when reading has to stop
+func (b *badLines) malformed(line []byte, reason string) bool {
+	if b.mode == ErrorsFatal {
+		b.err = &LineError{b.lines, string(line), reason}
+		return false
+	}
+
+	b.skipped++
+	if b.collect != nil {
+		b.collect(line)
+	}
+	return true
+}
+
+// newBadLines returns the malformed line handlers of n chunks, they share a lock so Options.BadLine is never called
+// concurrently
+func newBadLines(n int, opts Options) []badLines {
+	var collect func([]byte)
+	if opts.OnError == ErrorsCollect && opts.BadLine != nil {
+		var mu sync.Mutex
+		collect = func(line []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			opts.BadLine(line)
+		}
+	}
+
+	bad := make([]badLines, n)
+	for i := range bad {
+		bad[i] = badLines{mode: opts.OnError, collect: collect}
+	}
+	return bad
+}
+
+// lineErr returns the number of skipped lines of the chunks and the error of the first malformed line. The chunks
+// before the one that failed were read to the end, so their line counts give the number of the line over all chunks.
+func lineErr(bad []badLines) (int, error) {
+	skipped, lines := 0, 0
+	for _, b := range bad {
+		if b.err != nil {
+			err := *b.err
+			err.Line += lines
+			return skipped, &err
+		}
+		skipped += b.skipped
+		lines += b.lines
+	}
+	return skipped, nil
+}
@@ -0,0 +1,46 @@
+package brc
+
+import "sync"
+
+// MapStats describes how healthy the station tables were once the chunks were read, to check the hash function and
+// the sizing of the tables on an input. It is filled in while processing when set in the Options. Tables over a
+// StationSet are left out, they are indexed by its perfect hash and never probe.
+type MapStats struct {
+	mu         sync.Mutex
+	Tables     int     // number of station tables, one per chunk or shard
+	Stations   int     // number of stations summed over the tables
+	LoadFactor float64 // highest ratio of stations to slots of a table
+	Resizes    int     // number of times the tables grew, summed over the tables
+	MaxProbe   int     // longest probe sequence to find a station, 1 being its home slot
+	Collisions int     // stations which aren't in their home slot, summed over the tables
+}
+
+// recordTable adds the stats of a table to s, s may be nil. Every chunk records its own table.
+func recordTable[V any](s *MapStats, t *stationTable[V]) {
+	if s == nil || t.set != nil {
+		return
+	}
+
+	maxProbe, collisions := 0, 0
+	mask := len(t.slots) - 1
+	for i, slot := range t.slots {
+		if slot == 0 {
+			continue
+		}
+		home := int(t.entries[slot-1].hash) & mask
+		probe := (i-home)&mask + 1
+		maxProbe = max(maxProbe, probe)
+		if probe > 1 {
+			collisions++
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Tables++
+	s.Stations += len(t.entries)
+	s.LoadFactor = max(s.LoadFactor, float64(len(t.entries))/float64(len(t.slots)))
+	s.Resizes += t.resizes
+	s.MaxProbe = max(s.MaxProbe, maxProbe)
+	s.Collisions += collisions
+}
@@ -0,0 +1,50 @@
+package brc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMapStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		stations int
+		resizes  bool
+	}{
+		{"challenge stations", 413, false},
+		{"many stations", 10_000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input strings.Builder
+			for i := range tt.stations * 3 {
+				fmt.Fprintf(&input, "station-%d;%d.%d\n", i%tt.stations, i%100-50, i%10)
+			}
+
+			stats := &MapStats{}
+			_, err := ProcessInputs([]io.Reader{strings.NewReader(input.String())}, Options{MapStats: stats})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stats.Tables != 1 || stats.Stations != tt.stations {
+				t.Errorf("expected 1 table with %d stations, got %d tables with %d", tt.stations, stats.Tables, stats.Stations)
+			}
+			if stats.LoadFactor <= 0 || stats.LoadFactor > 0.5 {
+				t.Errorf("expected a load factor of at most one half, got %v", stats.LoadFactor)
+			}
+			if (stats.Resizes > 0) != tt.resizes {
+				t.Errorf("expected resizes %v, got %d", tt.resizes, stats.Resizes)
+			}
+			// with a good hash the probe sequences at a load factor of one half stay short
+			if stats.MaxProbe < 1 || stats.MaxProbe > 16 {
+				t.Errorf("expected a short longest probe sequence, got %d", stats.MaxProbe)
+			}
+			if stats.Collisions >= tt.stations/2 {
+				t.Errorf("expected fewer collisions than half the stations, got %d", stats.Collisions)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package brc
+
+import (
+	"maps"
+	"slices"
+)
+
+// Merge adds the results of other to r, as if their readings were aggregated together. The min, max, sum and
+// readings of stations in both are combined and their mean recomputed, stations only in other are appended in
+// their order. Value columns and custom aggregators are matched by name, the aggregators of stations only in other
+// are taken over rather than copied.
+func (r *Results) Merge(other Results) {
+	r.Skipped += other.Skipped
+	r.Excluded += other.Excluded
+
+	stations := make(map[string]*StationResult, len(r.Stations))
+	for _, s := range r.Stations {
+		stations[s.Station] = s
+	}
+
+	for _, o := range other.Stations {
+		s, ok := stations[o.Station]
+		if !ok {
+			// copy the station so later merges into r don't modify other
+			s = &StationResult{}
+			*s = *o
+			s.Columns = slices.Clone(o.Columns)
+			s.Percentiles = slices.Clone(o.Percentiles)
+			if o.Sketch != nil {
+				s.Sketch = o.Sketch.clone()
+			}
+			s.Histogram = slices.Clone(o.Histogram)
+			s.Aggregators = maps.Clone(o.Aggregators)
+			stations[s.Station] = s
+			r.Stations = append(r.Stations, s)
+			continue
+		}
+
+		s.merge(o)
+	}
+}
+
+func (s *StationResult) merge(other *StationResult) {
+	s.Min = min(s.Min, other.Min)
+	s.Max = max(s.Max, other.Max)
+	s.Sum += other.Sum
+	s.Readings += other.Readings
+	s.Mean = s.Sum / float64(s.Readings)
+	s.SumSquares += other.SumSquares
+	s.StdDev = stdDev(s.Sum, s.SumSquares, s.Readings)
+	mergeHistograms(s.Histogram, other.Histogram)
+	for name, o := range other.Aggregators {
+		if a, ok := s.Aggregators[name]; ok {
+			a.Merge(o)
+		} else {
+			if s.Aggregators == nil {
+				s.Aggregators = make(map[string]Aggregator)
+			}
+			s.Aggregators[name] = o
+		}
+	}
+	if s.Sketch != nil && other.Sketch != nil {
+		s.Sketch.Merge(other.Sketch)
+		s.estimatePercentiles()
+	}
+
+	for _, o := range other.Columns {
+		i := slices.IndexFunc(s.Columns, func(c ColumnResult) bool { return c.Column == o.Column })
+		if i < 0 {
+			s.Columns = append(s.Columns, o)
+			continue
+		}
+
+		c := &s.Columns[i]
+		c.Min = min(c.Min, o.Min)
+		c.Max = max(c.Max, o.Max)
+		c.Sum += o.Sum
+		c.Mean = c.Sum / float64(s.Readings)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin)
+
+package brc
+
+import (
+	"errors"
+	"os"
+)
+
+func mmapFile(file *os.File) ([]byte, error) {
+	return nil, errors.New("mmap is not supported on this platform")
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
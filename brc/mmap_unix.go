@@ -0,0 +1,30 @@
+//go:build linux || darwin
+
+package brc
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the whole file read only into memory
+func mmapFile(file *os.File) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// mapping an empty file fails, there is nothing to read anyway
+	if info.Size() == 0 {
+		return nil, nil
+	}
+
+	return syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(data []byte) error {
+	if data == nil {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,63 @@
+package brc
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization selects how the station names are normalized before the results are collected, stations which end
+// up with the same name are aggregated together
+type Normalization int
+
+const (
+	NormalizeTrim     Normalization = 1 << iota // trim the whitespace around the names, like "paris " to "paris"
+	NormalizeCaseFold                           // fold the case of the names, like "Paris" to "paris"
+	NormalizeNFC                                // compose the names, so São Paulo with a combining tilde becomes São Paulo with ã
+)
+
+// ParseNormalization parses a comma separated list of normalizations, trim, casefold and nfc
+func ParseNormalization(s string) (Normalization, error) {
+	var n Normalization
+	for _, name := range strings.Split(s, ",") {
+		switch name {
+		case "trim":
+			n |= NormalizeTrim
+		case "casefold":
+			n |= NormalizeCaseFold
+		case "nfc":
+			n |= NormalizeNFC
+		default:
+			return 0, fmt.Errorf("unknown normalization %q", name)
+		}
+	}
+	return n, nil
+}
+
+// rename returns the function renaming the stations with the normalization and then the rewrite of the options, or
+// nil when they leave the names alone
+func (o Options) rename() func(string) string {
+	if o.Normalize == 0 && o.Rewrite == nil {
+		return nil
+	}
+
+	fold := cases.Fold()
+	return func(name string) string {
+		if o.Normalize&NormalizeTrim != 0 {
+			name = strings.TrimSpace(name)
+		}
+		if o.Normalize&NormalizeCaseFold != 0 {
+			name = fold.String(name)
+		}
+		// after folding the case, which may decompose characters again
+		if o.Normalize&NormalizeNFC != 0 {
+			name = norm.NFC.String(name)
+		}
+		if o.Rewrite != nil {
+			name = o.Rewrite.Pattern.ReplaceAllString(name, o.Rewrite.Replacement)
+		}
+		return name
+	}
+}
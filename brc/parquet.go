@@ -0,0 +1,273 @@
+package brc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// The columns read from parquet measurements
+const (
+	ParquetStationColumn = "station"
+	ParquetReadingColumn = "temperature"
+)
+
+// ProcessParquet aggregates the measurements of a parquet file of size bytes, which has a string station column and
+// a numeric temperature column. The values are read column by column without any text parsing, the row groups are
+// read in parallel. With ParseFixed the readings are aggregated as exact tenths, like the text parser does. Multiple
+// value columns and sorted input aren't supported. Like ProcessInputsContext the results aggregated so far are
+// returned together with the error of ctx once it is done.
+func ProcessParquet(ctx context.Context, r io.ReaderAt, size int64, opts Options) (Results, error) {
+	err := opts.validate()
+	if err != nil {
+		return Results{}, err
+	}
+	if len(opts.Columns) > 1 || opts.SortedInput || opts.Offset > 0 || opts.Length > 0 || opts.Limit > 0 || opts.Sample > 0 || opts.Range != nil || opts.Quoted {
+		return Results{}, errors.New("multiple columns, sorted input, offset, length, a limit, sampling, a reading range and quoted names don't apply to parquet files")
+	}
+
+	file, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return Results{}, fmt.Errorf("opening parquet file failed: %w", err)
+	}
+	station, ok := file.Schema().Lookup(ParquetStationColumn)
+	if !ok {
+		return Results{}, fmt.Errorf("parquet file has no %s column", ParquetStationColumn)
+	}
+	reading, ok := file.Schema().Lookup(ParquetReadingColumn)
+	if !ok {
+		return Results{}, fmt.Errorf("parquet file has no %s column", ParquetReadingColumn)
+	}
+	columns := parquetColumns{station.ColumnIndex, reading.ColumnIndex}
+
+	var results Results
+	switch {
+	case opts.SkipValues:
+		results.Stations, results.Skipped, err = aggregateParquet(ctx, file.RowGroups(), columns, skipParquetValue, 1, opts)
+	case opts.Parser == ParseFloat:
+		results.Stations, results.Skipped, err = aggregateParquet(ctx, file.RowGroups(), columns, parquetFloat, 1, opts)
+	case opts.Parser == ParseInt:
+		results.Stations, results.Skipped, err = aggregateParquet(ctx, file.RowGroups(), columns, parquetInt, 1, opts)
+	default:
+		results.Stations, results.Skipped, err = aggregateParquet(ctx, file.RowGroups(), columns, parquetTenths, 10, opts)
+	}
+
+	return results, err
+}
+
+// parquetColumns are the indexes of the station and reading columns in the row groups
+type parquetColumns struct {
+	station int
+	reading int
+}
+
+// aggregateParquet is aggregate for the row groups of a parquet file, every row group is read as a chunk
+func aggregateParquet[T number](ctx context.Context, rowGroups []parquet.RowGroup, columns parquetColumns, convert func(parquet.Value) (T, bool), scale float64, opts Options) ([]*StationResult, int, error) {
+	extra := newExtraStats(opts, scale)
+	bad := newBadLines(len(rowGroups), opts)
+	chunkStations := make([]map[string]*stationAggregate[T], len(rowGroups))
+	chunkSeen := make([][]string, len(rowGroups))
+	chunkErrs := make([]error, len(rowGroups))
+
+	start := time.Now()
+	opts.Timings.startChunks(len(rowGroups))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(opts.Workers, 1))
+	for i, rowGroup := range rowGroups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if chunkErrs[i] = ctx.Err(); chunkErrs[i] != nil {
+				return
+			}
+
+			chunkStart := time.Now()
+			table := newChunkTable[stationAggregate[T]](opts)
+			chunkStations[i], chunkSeen[i], chunkErrs[i] = readParquetStations(rowGroup, columns, convert, extra, table, &bad[i])
+			recordTable(opts.MapStats, table)
+			opts.Timings.chunkRead(i, chunkStart, bad[i].lines)
+			if opts.Progress != nil {
+				opts.Progress.rows.Add(int64(bad[i].lines))
+			}
+		}()
+	}
+	wg.Wait()
+	start = opts.Timings.aggregated(start)
+
+	var ctxErr error
+	for _, err := range chunkErrs {
+		if isContextErr(err) {
+			ctxErr = err
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("reading parquet file failed: %w", err)
+		}
+	}
+	skipped, lineErr := lineErr(bad)
+	if lineErr != nil {
+		return nil, 0, lineErr
+	}
+
+	// row groups which weren't read because ctx was done are left out
+	for i := range chunkStations {
+		if chunkStations[i] == nil {
+			chunkStations[i] = map[string]*stationAggregate[T]{}
+		}
+	}
+
+	stations, seen := mergeStations(chunkStations, chunkSeen, (*stationAggregate[T]).merge)
+	if rename := opts.rename(); rename != nil {
+		stations, seen = rewriteStations(stations, seen, rename)
+	}
+	seen = filterStations(seen, opts.Stations)
+
+	stationsSlice := collectResults(stations, seen, scale)
+	setPercentiles(stationsSlice, opts.Percentiles)
+	opts.Timings.merged(start)
+	return stationsSlice, skipped, ctxErr
+}
+
+// readParquetStations aggregates the rows of a row group per station, it also returns the stations in the order
+// they were first encountered. Rows with a null station or reading, or a station the table can't hold, are malformed.
+func readParquetStations[T number](rowGroup parquet.RowGroup, columns parquetColumns, convert func(parquet.Value) (T, bool), extra extraStats, table *stationTable[stationAggregate[T]], bad *badLines) (map[string]*stationAggregate[T], []string, error) {
+	chunks := rowGroup.ColumnChunks()
+	names, err := readParquetColumn(chunks[columns.station])
+	if err != nil {
+		return nil, nil, err
+	}
+	readings, err := readParquetColumn(chunks[columns.reading])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(names) != len(readings) {
+		return nil, nil, fmt.Errorf("the columns of a row group have %d and %d values", len(names), len(readings))
+	}
+
+	for i := range names {
+		bad.lines++
+		name := names[i]
+		if name.IsNull() {
+			if !bad.malformed(readings[i].Bytes(), "missing station") {
+				break
+			}
+			continue
+		}
+		reading, ok := convert(readings[i])
+		if !ok {
+			if !bad.malformed(name.ByteArray(), "invalid reading") {
+				break
+			}
+			continue
+		}
+
+		v, inserted := table.get(name.ByteArray())
+		if v == nil {
+			if !bad.malformed(name.ByteArray(), "unknown station") {
+				break
+			}
+			continue
+		}
+		if inserted {
+			*v = stationAggregate[T]{Min: reading, Max: reading, Sum: reading, Readings: 1}
+		} else {
+			if v.Min > reading {
+				v.Min = reading
+			} else if v.Max < reading {
+				v.Max = reading
+			}
+			v.Sum += reading
+			v.Readings += 1
+		}
+		if extra.any() {
+			addExtra(v, reading, extra)
+		}
+	}
+
+	stations := make(map[string]*stationAggregate[T], len(table.entries))
+	seen := make([]string, 0, len(table.entries))
+	for i := range table.entries {
+		e := &table.entries[i]
+		stations[e.key] = &e.value
+		seen = append(seen, e.key)
+	}
+
+	return stations, seen, nil
+}
+
+// readParquetColumn reads all values of a column chunk
+func readParquetColumn(chunk parquet.ColumnChunk) ([]parquet.Value, error) {
+	values := make([]parquet.Value, 0, chunk.NumValues())
+	pages := chunk.Pages()
+	defer pages.Close()
+	for {
+		page, err := pages.ReadPage()
+		if errors.Is(err, io.EOF) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]parquet.Value, page.NumValues())
+		n, err := page.Values().ReadValues(buf)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		values = append(values, buf[:n]...)
+	}
+}
+
+func skipParquetValue(_ parquet.Value) (int64, bool) {
+	return 0, true
+}
+
+func parquetFloat(v parquet.Value) (float64, bool) {
+	switch v.Kind() {
+	case parquet.Double:
+		return v.Double(), true
+	case parquet.Float:
+		return float64(v.Float()), true
+	case parquet.Int32, parquet.Int64:
+		return float64(v.Int64()), true
+	default:
+		return 0, false
+	}
+}
+
+func parquetInt(v parquet.Value) (int64, bool) {
+	switch v.Kind() {
+	case parquet.Int32, parquet.Int64:
+		return v.Int64(), true
+	default:
+		return 0, false
+	}
+}
+
+// parquetTenths converts a reading to exact tenths, like parseTenths readings with more than one decimal are invalid
+func parquetTenths(v parquet.Value) (int64, bool) {
+	if v.Kind() == parquet.Int32 || v.Kind() == parquet.Int64 {
+		n := v.Int64()
+		if n > math.MaxInt64/10 || n < math.MinInt64/10 {
+			return 0, false
+		}
+		return n * 10, true
+	}
+
+	f, ok := parquetFloat(v)
+	if !ok {
+		return 0, false
+	}
+	tenths := math.Round(f * 10)
+	// floats can't hold most tenths exactly, allow for the error of the nearest float
+	if math.Abs(f*10-tenths) > 1e-6*max(1, math.Abs(tenths)) || math.Abs(tenths) > 1<<53 {
+		return 0, false
+	}
+	return int64(tenths), true
+}
@@ -0,0 +1,221 @@
+package brc
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+func parseFloat(b []byte) (float64, bool) {
+	return parseFloatPoint(b, '.')
+}
+
+// parseFloatComma is parseFloat for readings with a decimal comma, like 12,3
+func parseFloatComma(b []byte) (float64, bool) {
+	return parseFloatPoint(b, ',')
+}
+
+func parseFloatPoint(b []byte, point byte) (float64, bool) {
+	mant, exp, neg, trunc, _, n, ok := readFloat(string(b), point)
+	if !ok || n != len(b) {
+		return 0, false
+	}
+	if !trunc {
+		f, ok := atof64exact(mant, exp, neg) // this could be faster, but would require a different implementation which takes more shortcuts
+		if ok {
+			return f, true
+		}
+	}
+
+	// too many digits for the shortcut to be exact
+	s := string(b)
+	if point != '.' {
+		s = strings.Replace(s, string(point), ".", 1)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// skipValue doesn't parse the value at all, for when only the readings are counted
+func skipValue(_ []byte) (int64, bool) {
+	return 0, true
+}
+
+// parseInt parses a plain base 10 integer with an optional sign, without going through the float parser
+func parseInt(b []byte) (int64, bool) {
+	i := 0
+	neg := false
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		neg = b[0] == '-'
+		i++
+	}
+
+	// 18 digits always fit in an int64
+	if i == len(b) || len(b)-i > 18 {
+		return 0, false
+	}
+
+	var n int64
+	for ; i < len(b); i++ {
+		c := b[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+// parseTenths parses a decimal with at most one fractional digit directly into tenths, -12.3 becomes -123.
+// That is the format of the 1BRC readings, so it skips the float parser and keeps the aggregation exact.
+func parseTenths(b []byte) (int64, bool) {
+	return parseTenthsPoint(b, '.')
+}
+
+// parseTenthsComma is parseTenths for readings with a decimal comma, like 12,3
+func parseTenthsComma(b []byte) (int64, bool) {
+	return parseTenthsPoint(b, ',')
+}
+
+func parseTenthsPoint(b []byte, point byte) (int64, bool) {
+	if len(b) < 2 || b[len(b)-2] != point {
+		n, ok := parseInt(b)
+		if !ok || n > math.MaxInt64/10 || n < math.MinInt64/10 {
+			return 0, false
+		}
+		return n * 10, true
+	}
+
+	c := b[len(b)-1]
+	if c < '0' || c > '9' {
+		return 0, false
+	}
+	n, ok := parseInt(b[:len(b)-2])
+	if !ok || n > math.MaxInt64/10-1 || n < math.MinInt64/10+1 {
+		return 0, false
+	}
+
+	// checking the sign instead of n also handles -0.x
+	if b[0] == '-' {
+		return n*10 - int64(c-'0'), true
+	}
+	return n*10 + int64(c-'0'), true
+}
+
+// FROM STDLIB BUT UNNECESSARY PARTS REMOVED, THE DECIMAL POINT IS A PARAMETER
+func readFloat(s string, point byte) (mantissa uint64, exp int, neg, trunc, hex bool, i int, ok bool) {
+	// optional sign
+	if i >= len(s) {
+		return
+	}
+	switch {
+	case s[i] == '+':
+		i++
+	case s[i] == '-':
+		neg = true
+		i++
+	}
+
+	// digits
+	base := uint64(10)
+	maxMantDigits := 19 // 10^19 fits in uint64
+	sawdot := false
+	sawdigits := false
+	nd := 0
+	ndMant := 0
+	dp := 0
+loop:
+	for ; i < len(s); i++ {
+		switch c := s[i]; true {
+		case c == point:
+			if sawdot {
+				break loop
+			}
+			sawdot = true
+			dp = nd
+			continue
+
+		case '0' <= c && c <= '9':
+			sawdigits = true
+			if c == '0' && nd == 0 { // ignore leading zeros
+				dp--
+				continue
+			}
+			nd++
+			if ndMant < maxMantDigits {
+				mantissa *= base
+				mantissa += uint64(c - '0')
+				ndMant++
+			} else if c != '0' {
+				trunc = true
+			}
+			continue
+		}
+		break
+	}
+	if !sawdigits {
+		return
+	}
+	if !sawdot {
+		dp = nd
+	}
+
+	if mantissa != 0 {
+		exp = dp - ndMant
+	}
+
+	ok = true
+	return
+}
+
+type floatInfo struct {
+	mantbits uint
+	expbits  uint
+	bias     int
+}
+
+var float64info = floatInfo{52, 11, -1023}
+
+var float64pow10 = []float64{
+	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9,
+	1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19,
+	1e20, 1e21, 1e22,
+}
+
+func atof64exact(mantissa uint64, exp int, neg bool) (f float64, ok bool) {
+	if mantissa>>float64info.mantbits != 0 {
+		return
+	}
+	f = float64(mantissa)
+	if neg {
+		f = -f
+	}
+	switch {
+	case exp == 0:
+		// an integer.
+		return f, true
+	// Exact integers are <= 10^15.
+	// Exact powers of ten are <= 10^22.
+	case exp > 0 && exp <= 15+22: // int * 10^k
+		// If exponent is big but number of digits is not,
+		// can move a few zeros into the integer part.
+		if exp > 22 {
+			f *= float64pow10[exp-22]
+			exp = 22
+		}
+		if f > 1e15 || f < -1e15 {
+			// the exponent was really too large.
+			return
+		}
+		return f * float64pow10[exp], true
+	case exp < 0 && exp >= -22: // int / 10^k
+		return f / float64pow10[-exp], true
+	}
+	return
+}
+
+// END STDLIB EDITS
@@ -0,0 +1,71 @@
+package brc
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// parseSeeds are the corner cases the fuzz targets start from
+var parseSeeds = []string{
+	"", "-", "+", ".", "-.", "0", "-0", "00.0", "-0.0", "0.05", "1.", ".5", "-.5", "12.3", "-99.9",
+	"1.2.3", "1..2", "--1", "+-1", "1-", "1e5", "inf", "NaN",
+	"12345678901234567890", "1234567890123456789012345.5", "0.000000000000000000000000001", "9007199254740993",
+	"999999999999999999.9", "-9223372036854775808",
+}
+
+func FuzzParseTenths(f *testing.F) {
+	for _, s := range parseSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		got, ok := parseTenths([]byte(s))
+		want, err := strconv.ParseFloat(s, 64)
+
+		if ok && err != nil {
+			t.Fatalf("parseTenths(%q) = %d, strconv rejects it", s, got)
+		}
+		// beyond maxExactTenths the tenths round once more when converted back to a float64
+		if ok && math.Abs(want) <= maxExactTenths && float64(got)/10 != want {
+			t.Fatalf("parseTenths(%q) = %d, strconv parses it as %v", s, got, want)
+		}
+		if !ok && err == nil && plainDecimal([]byte(s), '.', ParseFixed) {
+			t.Fatalf("parseTenths(%q) rejected, strconv parses it as %v", s, want)
+		}
+	})
+}
+
+func FuzzReadFloat(f *testing.F) {
+	for _, s := range parseSeeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		got, ok := parseFloat([]byte(s))
+		want, err := strconv.ParseFloat(s, 64)
+
+		if ok && err != nil {
+			t.Fatalf("parseFloat(%q) = %v, strconv rejects it", s, got)
+		}
+		if ok && got != want {
+			t.Fatalf("parseFloat(%q) = %v, strconv parses it as %v", s, got, want)
+		}
+		if !ok && err == nil && plainDecimal([]byte(s), '.', ParseFloat) {
+			t.Fatalf("parseFloat(%q) rejected, strconv parses it as %v", s, want)
+		}
+	})
+}
+
+func TestParseFloatFixes(t *testing.T) {
+	if got, ok := parseFloat([]byte("1.2.3")); ok {
+		t.Errorf("parseFloat accepted 1.2.3 as %v", got)
+	}
+
+	// more digits than the exact shortcut converts fall back to strconv
+	for _, s := range []string{"12345678901234567890", "1234567890123456789012345.5", "9007199254740993"} {
+		want, _ := strconv.ParseFloat(s, 64)
+		got, ok := parseFloat([]byte(s))
+		if !ok || got != want {
+			t.Errorf("parseFloat(%q) = %v, %v, expected %v", s, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package brc
+
+// readParsedStations is readStations for lines split into the station and the reading by Options.ParseLine instead
+// of the separator, the readings being tenths of a degree. Lines it rejects are malformed.
+func readParsedStations[T number](scanner lineScanner, parseLine func([]byte) ([]byte, int, bool), extra extraStats, table *stationTable[stationAggregate[T]], bad *badLines, spill *spiller[T]) (map[string]*stationAggregate[T], []string) {
+	for scanner.Scan() {
+		bad.lines++
+		token := scanner.Bytes()
+		if len(token) == 0 {
+			continue
+		}
+
+		key, value, ok := parseLine(token)
+		if !ok {
+			if !bad.malformed(token, "line parser rejected the line") {
+				break
+			}
+			continue
+		}
+		reading := T(value)
+		v, inserted := table.get(key)
+		if v == nil {
+			if !bad.malformed(token, "unknown station") {
+				break
+			}
+			continue
+		}
+		if inserted {
+			*v = stationAggregate[T]{Min: reading, Max: reading, Sum: reading, Readings: 1}
+		} else {
+			if v.Min > reading {
+				v.Min = reading
+			} else if v.Max < reading {
+				v.Max = reading
+			}
+			v.Sum += reading
+			v.Readings += 1
+		}
+		if extra.any() {
+			addExtra(v, reading, extra)
+		}
+		if inserted && spill != nil && len(table.entries) >= spill.threshold {
+			spill.spill(table)
+		}
+	}
+	if spill != nil && spill.spilled() {
+		spill.spill(table)
+	}
+
+	stations := make(map[string]*stationAggregate[T], len(table.entries))
+	seen := make([]string, 0, len(table.entries))
+	for i := range table.entries {
+		e := &table.entries[i]
+		stations[e.key] = &e.value
+		seen = append(seen, e.key)
+	}
+
+	return stations, seen
+}
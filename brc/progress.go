@@ -0,0 +1,51 @@
+package brc
+
+import "sync/atomic"
+
+// Progress counts the lines read so far, it can be polled from another goroutine while the input is processed
+type Progress struct {
+	bytes atomic.Int64
+	rows  atomic.Int64
+}
+
+// Bytes returns the number of bytes read so far, line endings included
+func (p *Progress) Bytes() int64 {
+	return p.bytes.Load()
+}
+
+// Rows returns the number of lines read so far
+func (p *Progress) Rows() int64 {
+	return p.rows.Load()
+}
+
+// progressFlushRows is the number of lines a chunk reads before adding them to the shared counters
+const progressFlushRows = 1 << 14
+
+// progressLines counts the lines of its scanner, they are added to the progress in batches to keep the atomics
+// out of the per line work
+type progressLines struct {
+	lineScanner
+	progress *Progress
+	bytes    int64
+	rows     int64
+}
+
+func (p *progressLines) Scan() bool {
+	if !p.lineScanner.Scan() {
+		p.flush()
+		return false
+	}
+
+	p.bytes += int64(len(p.Bytes())) + 1
+	p.rows++
+	if p.rows == progressFlushRows {
+		p.flush()
+	}
+	return true
+}
+
+func (p *progressLines) flush() {
+	p.progress.bytes.Add(p.bytes)
+	p.progress.rows.Add(p.rows)
+	p.bytes, p.rows = 0, 0
+}
@@ -0,0 +1,51 @@
+package brc
+
+import "bytes"
+
+// quotedLine returns the line parser of Options.Quoted, which splits a line at the separator after the station name
+// like the regular parser unless the name is quoted. A quoted name ends at its closing quote, so it may contain the
+// separator, and a quote within it is doubled.
+func quotedLine(sep byte, parse func([]byte) (int64, bool)) func(line []byte) ([]byte, int, bool) {
+	return func(line []byte) ([]byte, int, bool) {
+		var station, rest []byte
+		if line[0] == '"' {
+			var ok bool
+			station, rest, ok = unquote(line[1:])
+			if !ok || len(rest) == 0 || rest[0] != sep {
+				return nil, 0, false
+			}
+			rest = rest[1:]
+		} else {
+			i := indexByte(line, sep)
+			if i < 0 {
+				return nil, 0, false
+			}
+			station, rest = line[:i], line[i+1:]
+		}
+
+		reading, ok := parse(rest)
+		return station, int(reading), ok
+	}
+}
+
+// unquote returns the quoted name b starts with up to its closing quote, with the doubled quotes in it undoubled,
+// and the bytes after the closing quote. The name points into b unless it had doubled quotes.
+func unquote(b []byte) (name []byte, rest []byte, ok bool) {
+	var undoubled []byte
+	for {
+		i := bytes.IndexByte(b, '"')
+		if i < 0 {
+			return nil, nil, false
+		}
+		if i+1 < len(b) && b[i+1] == '"' {
+			undoubled = append(undoubled, b[:i+1]...)
+			b = b[i+2:]
+			continue
+		}
+
+		if undoubled == nil {
+			return b[:i], b[i+1:], true
+		}
+		return append(undoubled, b[:i]...), b[i+1:], true
+	}
+}
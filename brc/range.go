@@ -0,0 +1,49 @@
+package brc
+
+import "math"
+
+// ReadingRange is the range of readings which are aggregated, in degrees and including the bounds. Readings outside
+// of it are left out and counted in Results.Excluded.
+type ReadingRange struct {
+	Min, Max float64
+}
+
+// AllReadings is the range including every reading, to only bound one side of a range
+var AllReadings = ReadingRange{math.Inf(-1), math.Inf(1)}
+
+// rangeLines blanks the lines of its scanner with a reading outside of the range, counting them. The aggregation
+// ignores empty lines but still counts them, so malformed lines keep their line number. Lines without a valid reading
+// are returned as they are, the aggregation handles them as malformed.
+type rangeLines struct {
+	lineScanner
+	opts     Options
+	excluded int
+	blank    bool
+}
+
+func (r *rangeLines) Scan() bool {
+	if !r.lineScanner.Scan() {
+		return false
+	}
+
+	r.blank = false
+	line := r.lineScanner.Bytes()
+	i := indexByte(line, r.opts.separator())
+	if i < 0 {
+		return true
+	}
+	reading, ok := ParseReading(line[i+1:], r.opts)
+	if !ok || reading >= r.opts.Range.Min && reading <= r.opts.Range.Max {
+		return true
+	}
+	r.excluded++
+	r.blank = true
+	return true
+}
+
+func (r *rangeLines) Bytes() []byte {
+	if r.blank {
+		return nil
+	}
+	return r.lineScanner.Bytes()
+}
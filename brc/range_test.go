@@ -0,0 +1,44 @@
+package brc
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRangeLineNumbers(t *testing.T) {
+	input := "A;-5.0\nA;-6.0\nB;xx\n"
+	opts := Options{Range: &ReadingRange{0, math.Inf(1)}}
+
+	_, err := ProcessInputs([]io.Reader{strings.NewReader(input)}, opts)
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) {
+		t.Fatalf("expected a *LineError, got %v", err)
+	}
+	if lineErr.Line != 3 {
+		t.Errorf("expected the malformed line on line 3, got line %d", lineErr.Line)
+	}
+}
+
+func TestRangeExcluded(t *testing.T) {
+	input := "A;-5.0\nA;1.0\nB;30.0\nB;2.0\n"
+	opts := Options{Range: &ReadingRange{0, 10}}
+
+	results, err := ProcessInputs([]io.Reader{strings.NewReader(input)}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Excluded != 2 {
+		t.Errorf("expected 2 excluded readings, got %d", results.Excluded)
+	}
+	if len(results.Stations) != 2 {
+		t.Fatalf("expected 2 stations, got %d", len(results.Stations))
+	}
+	for _, s := range results.Stations {
+		if s.Readings != 1 {
+			t.Errorf("expected 1 reading of %s, got %d", s.Station, s.Readings)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package brc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// lineScanner iterates over the lines of the input, it is a subset of bufio.Scanner
+type lineScanner interface {
+	Scan() bool
+	Bytes() []byte
+	Err() error
+}
+
+// byteLines iterates over the lines of a byte slice without copying them, like bufio.Scanner it drops a trailing \r
+type byteLines struct {
+	data []byte
+	line []byte
+}
+
+func (b *byteLines) Scan() bool {
+	if len(b.data) == 0 {
+		return false
+	}
+
+	i := indexByte(b.data, '\n')
+	if i < 0 {
+		b.line, b.data = b.data, nil
+	} else {
+		b.line, b.data = b.data[:i], b.data[i+1:]
+	}
+	b.line = dropCR(b.line)
+
+	return true
+}
+
+func dropCR(line []byte) []byte {
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		return line[:len(line)-1]
+	}
+	return line
+}
+
+func (b *byteLines) Bytes() []byte {
+	return b.line
+}
+
+func (b *byteLines) Err() error {
+	return nil
+}
+
+// concatLines reads all lines of its scanners one after the other
+type concatLines struct {
+	scanners []lineScanner
+}
+
+func (c *concatLines) Scan() bool {
+	for len(c.scanners) > 0 {
+		if c.scanners[0].Scan() {
+			return true
+		}
+		if c.scanners[0].Err() != nil {
+			return false
+		}
+		c.scanners = c.scanners[1:]
+	}
+
+	return false
+}
+
+func (c *concatLines) Bytes() []byte {
+	return c.scanners[0].Bytes()
+}
+
+func (c *concatLines) Err() error {
+	if len(c.scanners) == 0 {
+		return nil
+	}
+	return c.scanners[0].Err()
+}
+
+// limitLines stops its scanner after the given number of lines
+type limitLines struct {
+	lineScanner
+	remaining int64
+}
+
+func (l *limitLines) Scan() bool {
+	if l.remaining == 0 {
+		return false
+	}
+	l.remaining--
+	return l.lineScanner.Scan()
+}
+
+// contextCheckRows is the number of lines read between checks whether the context is done
+const contextCheckRows = 1 << 14
+
+// contextLines stops its scanner once ctx is done, Err then returns the error of ctx
+type contextLines struct {
+	lineScanner
+	ctx  context.Context
+	rows int
+	err  error
+}
+
+func (c *contextLines) Scan() bool {
+	c.rows++
+	if c.rows == contextCheckRows {
+		c.rows = 0
+		if c.err = c.ctx.Err(); c.err != nil {
+			return false
+		}
+	}
+	return c.lineScanner.Scan()
+}
+
+func (c *contextLines) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.lineScanner.Err()
+}
+
+// blockLines reads large blocks from r and iterates over their lines in place. The partial line at the end of a
+// block is moved to the front of the buffer before the next block is read after it, the buffer only grows when a
+// single line doesn't fit in it. When ioSem is set a read only starts once it can send to it, limiting the number
+// of reads in flight over all chunks sharing it.
+type blockLines struct {
+	r       io.Reader
+	ioSem   chan struct{}
+	bufSize int
+	buf     []byte
+	data    []byte // unread part of the buffer
+	line    []byte
+	eof     bool
+	err     error
+}
+
+func newBlockLines(r io.Reader, bufSize int, ioSem chan struct{}) *blockLines {
+	return &blockLines{r: r, ioSem: ioSem, bufSize: bufSize}
+}
+
+func (b *blockLines) Scan() bool {
+	for {
+		if i := indexByte(b.data, '\n'); i >= 0 {
+			b.line, b.data = dropCR(b.data[:i]), b.data[i+1:]
+			return true
+		}
+		if b.err != nil {
+			return false
+		}
+		if b.eof {
+			if len(b.data) == 0 {
+				b.buf = nil // the buffer isn't needed anymore, don't keep it alive until all chunks are read
+				return false
+			}
+			b.line, b.data = dropCR(b.data), nil
+			return true
+		}
+
+		if b.buf == nil {
+			b.buf = make([]byte, b.bufSize)
+		}
+		n := copy(b.buf, b.data)
+		if n == len(b.buf) {
+			b.buf = slices.Grow(b.buf[:n], n)[:2*n]
+		}
+
+		if b.ioSem != nil {
+			b.ioSem <- struct{}{}
+		}
+		read, err := b.r.Read(b.buf[n:])
+		if b.ioSem != nil {
+			<-b.ioSem
+		}
+		b.data = b.buf[:n+read]
+		if errors.Is(err, io.EOF) {
+			b.eof = true
+		} else if err != nil {
+			b.err = err
+		}
+	}
+}
+
+func (b *blockLines) Bytes() []byte {
+	return b.line
+}
+
+func (b *blockLines) Err() error {
+	return b.err
+}
+
+// lineRange returns the bytes of the lines of file starting within length bytes from offset, a length of 0 meaning
+// up to the end of the file. Splitting a file into consecutive ranges this way assigns every line to exactly one range.
+// A byte order mark at the start of the file is left out of the first range.
+func lineRange(file *os.File, offset int64, length int64) (start int64, end int64, err error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := info.Size()
+
+	start, err = nextLineStart(file, min(offset, size))
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == 0 {
+		mark := make([]byte, len(byteOrderMark))
+		n, _ := file.ReadAt(mark, 0)
+		if string(mark[:n]) == byteOrderMark {
+			start = int64(n)
+		}
+	}
+
+	end = size
+	if length > 0 && offset+length < size {
+		end, err = nextLineStart(file, offset+length)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return start, max(start, end), nil
+}
+
+// byteOrderMark is the UTF-8 byte order mark some editors and exports start a file with, it isn't part of the first
+// station name
+const byteOrderMark = "\xef\xbb\xbf"
+
+// skipBOM returns r without the byte order mark it may start with
+func skipBOM(r io.Reader) io.Reader {
+	// reads into buffers larger than that of the bufio.Reader go straight to r once the mark is skipped
+	br := bufio.NewReaderSize(r, 16)
+	mark, _ := br.Peek(len(byteOrderMark))
+	if string(mark) == byteOrderMark {
+		br.Discard(len(mark))
+	}
+	return br
+}
+
+// splitFile splits the bytes from start to end of the file into at most n chunks of roughly equal size, start and
+// every chunk start at the beginning of a line
+func splitFile(file *os.File, start int64, end int64, n int) ([]io.Reader, error) {
+	size := end - start
+
+	offsets := []int64{start}
+	for i := 1; i < n; i++ {
+		offset, err := nextLineStart(file, start+size*int64(i)/int64(n))
+		if err != nil {
+			return nil, err
+		}
+		if offset >= end {
+			break
+		}
+		if offset > offsets[len(offsets)-1] {
+			offsets = append(offsets, offset)
+		}
+	}
+	offsets = append(offsets, end)
+
+	chunks := make([]io.Reader, 0, len(offsets)-1)
+	for i := range len(offsets) - 1 {
+		chunks = append(chunks, io.NewSectionReader(file, offsets[i], offsets[i+1]-offsets[i]))
+	}
+
+	return chunks, nil
+}
+
+// splitBytes splits data into at most n chunks of roughly equal size, every chunk starts at the beginning of a line
+func splitBytes(data []byte, n int) [][]byte {
+	chunks := make([][]byte, 0, n)
+	for i := n; i > 1 && len(data) > 0; i-- {
+		end := len(data) / i
+		j := slices.Index(data[end:], '\n')
+		if j < 0 {
+			break
+		}
+		end += j + 1
+
+		chunks = append(chunks, data[:end])
+		data = data[end:]
+	}
+
+	return append(chunks, data)
+}
+
+// nextLineStart returns the offset of the first line starting at or after offset
+func nextLineStart(file *os.File, offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+
+	// start at the byte before the offset, in case the offset already is the start of a line
+	pos := offset - 1
+	buf := make([]byte, 4096)
+	for {
+		n, err := file.ReadAt(buf, pos)
+		if i := slices.Index(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return pos + int64(n), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		pos += int64(n)
+	}
+}
+
+// readParallel reads every chunk on its own goroutine, at most workers at a time so many input files don't all
+// hold a read buffer at once. read is called with the index of the chunk.
+func readParallel(chunks []lineScanner, workers int, read func(int, lineScanner)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(workers, 1))
+	for i, chunk := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			read(i, chunk)
+			<-sem
+		}()
+	}
+	wg.Wait()
+}
+
+// readErr returns the first error of the chunks that failed to be read, it is only final once readParallel returned.
+// The error of a done context is returned as is.
+func readErr(chunks []lineScanner) error {
+	var ctxErr error
+	for _, chunk := range chunks {
+		err := chunk.Err()
+		if isContextErr(err) {
+			ctxErr = err
+		} else if err != nil {
+			return fmt.Errorf("reading input failed: %w", err)
+		}
+	}
+	return ctxErr
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
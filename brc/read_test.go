@@ -0,0 +1,117 @@
+package brc
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// lineInputs are inputs with CRLF line endings and without a newline after the last line, with the lines of them
+var lineInputs = []struct {
+	name  string
+	input string
+	lines []string
+}{
+	{"lf", "A;1.0\nB;-2.5\nC;3.0\n", []string{"A;1.0", "B;-2.5", "C;3.0"}},
+	{"crlf", "A;1.0\r\nB;-2.5\r\nC;3.0\r\n", []string{"A;1.0", "B;-2.5", "C;3.0"}},
+	{"no final newline", "A;1.0\nB;-2.5\nC;3.0", []string{"A;1.0", "B;-2.5", "C;3.0"}},
+	{"crlf without final newline", "A;1.0\r\nB;-2.5\r\nC;3.0", []string{"A;1.0", "B;-2.5", "C;3.0"}},
+	{"final cr", "A;1.0\r\nB;-2.5\r\nC;3.0\r", []string{"A;1.0", "B;-2.5", "C;3.0"}},
+}
+
+// scanLines returns all lines of scanner
+func scanLines(t *testing.T, scanner lineScanner) []string {
+	t.Helper()
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, string(scanner.Bytes()))
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestByteLines(t *testing.T) {
+	for _, tt := range lineInputs {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := scanLines(t, &byteLines{data: []byte(tt.input)})
+			if !slices.Equal(lines, tt.lines) {
+				t.Errorf("expected %q, got %q", tt.lines, lines)
+			}
+		})
+	}
+}
+
+func TestBlockLines(t *testing.T) {
+	for _, tt := range lineInputs {
+		t.Run(tt.name, func(t *testing.T) {
+			// every buffer size up to the whole input, which puts a block boundary between every \r and \n
+			for bufSize := 1; bufSize <= len(tt.input); bufSize++ {
+				lines := scanLines(t, newBlockLines(strings.NewReader(tt.input), bufSize, nil))
+				if !slices.Equal(lines, tt.lines) {
+					t.Errorf("buffer size %d: expected %q, got %q", bufSize, tt.lines, lines)
+				}
+				lines = scanLines(t, newBlockLines(iotest.OneByteReader(strings.NewReader(tt.input)), bufSize, nil))
+				if !slices.Equal(lines, tt.lines) {
+					t.Errorf("buffer size %d reading single bytes: expected %q, got %q", bufSize, tt.lines, lines)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessLineEndings(t *testing.T) {
+	for _, tt := range lineInputs {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "measurements.txt")
+			if err := os.WriteFile(path, []byte(tt.input), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			check := func(name string, input func() io.Reader, opts Options) {
+				t.Helper()
+				results, err := ProcessInputs([]io.Reader{input()}, opts)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				var stations []string
+				for _, s := range results.Stations {
+					stations = append(stations, s.Station)
+				}
+				if !slices.Equal(stations, []string{"A", "B", "C"}) || results.Stations[2].Max != 3 {
+					t.Errorf("%s: expected the stations A, B and C with C at 3.0, got %q", name, stations)
+				}
+			}
+			file := func() io.Reader {
+				f, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { f.Close() })
+				return f
+			}
+			// stdin is a pipe, which is read as a stream
+			stdin := func() io.Reader {
+				r, w, err := os.Pipe()
+				if err != nil {
+					t.Fatal(err)
+				}
+				go func() {
+					io.WriteString(w, tt.input)
+					w.Close()
+				}()
+				t.Cleanup(func() { r.Close() })
+				return r
+			}
+
+			check("file", file, Options{Workers: 2})
+			check("mmap", file, Options{Workers: 2, Mmap: true})
+			check("stdin", stdin, Options{BufferSize: 4})
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package brc
+
+import "math"
+
+// Round rounds v to one decimal, rounding halves up like the reference implementation does with Math.round(v * 10.0) / 10.0.
+// Negative zero is returned as zero so it isn't printed as -0.0.
+func Round(v float64) float64 {
+	v *= 10
+	r := math.Floor(v)
+	// comparing the remainder instead of flooring v + 0.5 also rounds 0.49999999999999994 correctly
+	if v-r >= 0.5 {
+		r++
+	}
+	if r == 0 {
+		return 0
+	}
+	return r / 10
+}
+
+// Rounded returns a copy of the results with the min, mean, max and standard deviation of every station rounded to one decimal
+func (r Results) Rounded() Results {
+	stations := make([]*StationResult, len(r.Stations))
+	for i, s := range r.Stations {
+		rounded := *s
+		rounded.Min, rounded.Mean, rounded.Max, rounded.StdDev = Round(s.Min), Round(s.Mean), Round(s.Max), Round(s.StdDev)
+		if s.Percentiles != nil {
+			rounded.Percentiles = make([]Percentile, len(s.Percentiles))
+			for i, p := range s.Percentiles {
+				rounded.Percentiles[i] = Percentile{p.Quantile, Round(p.Value)}
+			}
+		}
+		if s.Columns != nil {
+			rounded.Columns = make([]ColumnResult, len(s.Columns))
+			for c, column := range s.Columns {
+				rounded.Columns[c] = ColumnResult{column.Column, Round(column.Min), Round(column.Max), Round(column.Mean), column.Sum}
+			}
+		}
+		stations[i] = &rounded
+	}
+
+	return Results{stations, r.Skipped, r.Excluded}
+}
@@ -0,0 +1,45 @@
+package brc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRound(t *testing.T) {
+	// the expected values are those of Math.round(v * 10.0) / 10.0 in the Java baseline
+	tests := []struct {
+		v    float64
+		want float64
+	}{
+		{0, 0},
+		{-0.05, 0},
+		{-0.04, 0},
+		{0.05, 0.1},
+		{-0.15, -0.1},
+		{0.15, 0.2},
+		{1.25, 1.3},
+		{-1.25, -1.2},
+		{2.35, 2.4},
+		{-12.34, -12.3},
+		{99.95, 100},
+
+		// one ulp either side of the halves
+		{math.Nextafter(0.05, 0), 0},
+		{math.Nextafter(0.05, 1), 0.1},
+		{math.Nextafter(-0.05, -1), -0.1},
+		{math.Nextafter(-0.05, 0), 0},
+		{math.Nextafter(-0.15, -1), -0.2},
+		{math.Nextafter(-0.15, 0), -0.1},
+		{math.Nextafter(1.25, 0), 1.2},
+		{math.Nextafter(1.25, 2), 1.3},
+	}
+	for _, tt := range tests {
+		got := Round(tt.v)
+		if got != tt.want {
+			t.Errorf("Round(%v) = %v, expected %v", tt.v, got, tt.want)
+		}
+		if got == 0 && math.Signbit(got) {
+			t.Errorf("Round(%v) = -0, expected 0 so it isn't printed as -0.0", tt.v)
+		}
+	}
+}
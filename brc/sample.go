@@ -0,0 +1,85 @@
+package brc
+
+import (
+	"math"
+	"os"
+)
+
+// sampleBlockSize is the largest block regular files are sampled in, smaller files are split into sampleBlocks
+// blocks so a small sample still spreads over the whole file
+const (
+	sampleBlockSize = 1 << 20
+	sampleBlocks    = 4096
+)
+
+// sampled reports whether the i-th of evenly spaced items is in a sample of fraction of them, which are every
+// 1/fraction-th item starting with the first
+func sampled(i int64, fraction float64) bool {
+	return i == 0 || math.Floor(float64(i)*fraction) != math.Floor(float64(i-1)*fraction)
+}
+
+// sampleFile returns the start and end offsets of the blocks of the file from start to end which a sample of
+// fraction of it reads. Every block starts at the beginning of a line, a line belongs to the block it starts in.
+func sampleFile(file *os.File, start int64, end int64, fraction float64) ([][2]int64, error) {
+	block := min(sampleBlockSize, max((end-start)/sampleBlocks, 4096))
+
+	var blocks [][2]int64
+	for i := int64(0); start+i*block < end; i++ {
+		if !sampled(i, fraction) {
+			continue
+		}
+
+		from, err := nextLineStart(file, start+i*block)
+		if err != nil {
+			return nil, err
+		}
+		to := end
+		if start+(i+1)*block < end {
+			to, err = nextLineStart(file, start+(i+1)*block)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if from < to {
+			blocks = append(blocks, [2]int64{from, min(to, end)})
+		}
+	}
+	return blocks, nil
+}
+
+// groupBlocks splits blocks into at most n groups of consecutive blocks with roughly the same number of blocks
+func groupBlocks(blocks [][2]int64, n int) [][][2]int64 {
+	groups := make([][][2]int64, 0, n)
+	for i := n; i > 0 && len(blocks) > 0; i-- {
+		size := (len(blocks) + i - 1) / i
+		groups = append(groups, blocks[:size])
+		blocks = blocks[size:]
+	}
+	return groups
+}
+
+// sampleLines blanks the lines of its scanner which aren't in a sample of fraction of them, for input which can't be
+// sampled in blocks. The aggregation ignores empty lines but still counts them, so malformed lines keep their line
+// number.
+type sampleLines struct {
+	lineScanner
+	fraction float64
+	line     int64
+	blank    bool
+}
+
+func (s *sampleLines) Scan() bool {
+	if !s.lineScanner.Scan() {
+		return false
+	}
+	s.line++
+	s.blank = !sampled(s.line-1, s.fraction)
+	return true
+}
+
+func (s *sampleLines) Bytes() []byte {
+	if s.blank {
+		return nil
+	}
+	return s.lineScanner.Bytes()
+}
@@ -0,0 +1,40 @@
+package brc
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSampleLineNumbers(t *testing.T) {
+	// every other line is sampled starting with the first, so the malformed third line is in the sample
+	input := "A;1.0\nA;2.0\nB;xx\n"
+	opts := Options{Sample: 0.5}
+
+	_, err := ProcessInputs([]io.Reader{strings.NewReader(input)}, opts)
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) {
+		t.Fatalf("expected a *LineError, got %v", err)
+	}
+	if lineErr.Line != 3 {
+		t.Errorf("expected the malformed line on line 3, got line %d", lineErr.Line)
+	}
+}
+
+func TestSampleStream(t *testing.T) {
+	input := "A;1.0\nA;2.0\nA;3.0\nA;4.0\nA;5.0\n"
+	opts := Options{Sample: 0.5}
+
+	results, err := ProcessInputs([]io.Reader{strings.NewReader(input)}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Stations) != 1 {
+		t.Fatalf("expected 1 station, got %d", len(results.Stations))
+	}
+	s := results.Stations[0]
+	if s.Readings != 3 || s.Min != 1 || s.Max != 5 || s.Sum != 9 {
+		t.Errorf("expected the readings 1.0, 3.0 and 5.0, got %+v", *s)
+	}
+}
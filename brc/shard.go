@@ -0,0 +1,97 @@
+package brc
+
+import "sync"
+
+// shardBits is the number of hash bits picking the shard of a station, enough shards for the workers to rarely wait
+// on each other's locks
+const shardBits = 6
+
+// shardedTable is a station table shared by all chunks, split into shards by the hash of the station which each
+// have their own lock. There is nothing to merge after reading, at the cost of taking a lock for every line.
+type shardedTable[T number] struct {
+	shards [1 << shardBits]tableShard[T]
+}
+
+type tableShard[T number] struct {
+	mu    sync.Mutex
+	table *stationTable[stationAggregate[T]]
+	_     [48]byte // pads the shard to a cache line, so locking a shard doesn't contend with its neighbours
+}
+
+func newShardedTable[T number](expectedStations int) *shardedTable[T] {
+	t := &shardedTable[T]{}
+	for i := range t.shards {
+		t.shards[i].table = newStationTable[stationAggregate[T]](expectedStations >> shardBits)
+	}
+	return t
+}
+
+// shard returns the shard of a station by its StationHash. The hash is mixed first, as the high bits of FNV-1a are
+// alike for similar names and the low bits pick the slot within the shard.
+func (t *shardedTable[T]) shard(hash uint64) *tableShard[T] {
+	return &t.shards[mixHash(hash)>>(64-shardBits)]
+}
+
+// stations returns all stations of the shards, shard by shard in the order they were first seen in every shard
+func (t *shardedTable[T]) stations() (map[string]*stationAggregate[T], []string) {
+	count := 0
+	for i := range t.shards {
+		count += len(t.shards[i].table.entries)
+	}
+
+	stations := make(map[string]*stationAggregate[T], count)
+	seen := make([]string, 0, count)
+	for i := range t.shards {
+		table := t.shards[i].table
+		for j := range table.entries {
+			e := &table.entries[j]
+			stations[e.key] = &e.value
+			seen = append(seen, e.key)
+		}
+	}
+	return stations, seen
+}
+
+// readShardedStations aggregates every line of the scanner per station into the shards, locking the shard of the
+// station for every line. It stops at the first malformed line when bad says so.
+func readShardedStations[T number](scanner lineScanner, sep byte, parse func([]byte) (T, bool), extra extraStats, shards *shardedTable[T], bad *badLines) {
+	for scanner.Scan() {
+		bad.lines++
+		token := scanner.Bytes()
+		i, hash := indexByteHash(token, sep)
+
+		if i < 0 {
+			if len(token) > 0 && !bad.malformed(token, "missing separator") {
+				break
+			}
+			continue
+		}
+
+		reading, ok := parse(token[i+1:])
+		if !ok {
+			if !bad.malformed(token, "invalid reading") {
+				break
+			}
+			continue
+		}
+
+		shard := shards.shard(hash)
+		shard.mu.Lock()
+		v, inserted := shard.table.getHash(token[:i], hash)
+		if inserted {
+			*v = stationAggregate[T]{Min: reading, Max: reading, Sum: reading, Readings: 1}
+		} else {
+			if v.Min > reading {
+				v.Min = reading
+			} else if v.Max < reading {
+				v.Max = reading
+			}
+			v.Sum += reading
+			v.Readings += 1
+		}
+		if extra.any() {
+			addExtra(v, reading, extra)
+		}
+		shard.mu.Unlock()
+	}
+}
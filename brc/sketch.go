@@ -0,0 +1,197 @@
+package brc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"math"
+	"slices"
+)
+
+// sketchBucketsPerDecade is the number of buckets a sketch has for every factor of 10. Its buckets are
+// 10^(1/115) apart, a relative accuracy of 1%, and scaling the readings by a power of 10 shifts the buckets by a
+// whole number, so the sketch of parsed tenths can be turned into the sketch of the actual readings.
+const sketchBucketsPerDecade = 115
+
+var (
+	sketchGamma    = math.Pow(10, 1.0/sketchBucketsPerDecade)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// sketchTenths caches the bucket of the integers below 1000, which covers every reading of the fixed parser and
+// keeps the logarithm out of the hot loop
+var sketchTenths = func() (buckets [1000]int) {
+	for v := 1; v < len(buckets); v++ {
+		buckets[v] = sketchLogBucket(float64(v))
+	}
+	return buckets
+}()
+
+// sketchZero is the magnitude below which readings are counted as zero, it bounds the number of buckets
+const sketchZero = 1e-9
+
+func sketchBucket(v float64) int {
+	if v < float64(len(sketchTenths)) && v == math.Trunc(v) {
+		return sketchTenths[int(v)]
+	}
+	return sketchLogBucket(v)
+}
+
+func sketchLogBucket(v float64) int {
+	return int(math.Ceil(math.Log(v) / sketchLogGamma))
+}
+
+// Sketch estimates the quantiles of readings within a relative error of 1% in bounded memory (a DDSketch), every
+// reading is counted in the bucket of its magnitude. Sketches of separate readings can be merged exactly. The buckets
+// only span the magnitudes of the readings, readings from 0.1 to 100 degrees take about 350 of them, so its memory
+// doesn't grow with the number of readings.
+type Sketch struct {
+	positive sketchStore
+	negative sketchStore
+	zero     uint64
+	count    uint64
+}
+
+// Add counts the reading v in the sketch
+func (s *Sketch) Add(v float64) {
+	s.count++
+	switch {
+	case v >= sketchZero:
+		s.positive.add(sketchBucket(v), 1)
+	case v <= -sketchZero:
+		s.negative.add(sketchBucket(-v), 1)
+	default:
+		s.zero++
+	}
+}
+
+// Merge adds the readings counted by other to s
+func (s *Sketch) Merge(other *Sketch) {
+	s.positive.merge(&other.positive)
+	s.negative.merge(&other.negative)
+	s.zero += other.zero
+	s.count += other.count
+}
+
+// Quantile returns the estimated reading below which a fraction q of the readings lie, q being between 0 and 1
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.count-1))
+
+	// the negative readings come first, the largest magnitude being the lowest reading
+	var seen uint64
+	for i := len(s.negative.counts) - 1; i >= 0; i-- {
+		seen += s.negative.counts[i]
+		if seen > rank {
+			return -sketchValue(s.negative.offset + i)
+		}
+	}
+	seen += s.zero
+	if seen > rank {
+		return 0
+	}
+	for i, c := range s.positive.counts {
+		seen += c
+		if seen > rank {
+			return sketchValue(s.positive.offset + i)
+		}
+	}
+	return sketchValue(s.positive.offset + len(s.positive.counts) - 1)
+}
+
+// sketchGob is the encoding of a sketch with gob and json, which can't encode its unexported fields
+type sketchGob struct {
+	PositiveOffset int      `json:"positive_offset"`
+	Positive       []uint64 `json:"positive"`
+	NegativeOffset int      `json:"negative_offset"`
+	Negative       []uint64 `json:"negative"`
+	Zero           uint64   `json:"zero"`
+	Count          uint64   `json:"count"`
+}
+
+// GobEncode encodes the sketch, so results with sketches can be stored and loaded again with encoding/gob
+func (s *Sketch) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(sketchGob{s.positive.offset, s.positive.counts, s.negative.offset, s.negative.counts, s.zero, s.count})
+	return buf.Bytes(), err
+}
+
+func (s *Sketch) GobDecode(data []byte) error {
+	var g sketchGob
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&g)
+	if err != nil {
+		return err
+	}
+	*s = Sketch{sketchStore{g.PositiveOffset, g.Positive}, sketchStore{g.NegativeOffset, g.Negative}, g.Zero, g.Count}
+	return nil
+}
+
+// MarshalJSON encodes the sketch, so results with sketches can be stored as json and merged again
+func (s *Sketch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sketchGob{s.positive.offset, s.positive.counts, s.negative.offset, s.negative.counts, s.zero, s.count})
+}
+
+func (s *Sketch) UnmarshalJSON(data []byte) error {
+	var g sketchGob
+	err := json.Unmarshal(data, &g)
+	if err != nil {
+		return err
+	}
+	*s = Sketch{sketchStore{g.PositiveOffset, g.Positive}, sketchStore{g.NegativeOffset, g.Negative}, g.Zero, g.Count}
+	return nil
+}
+
+func (s *Sketch) clone() *Sketch {
+	clone := *s
+	clone.positive.counts = slices.Clone(s.positive.counts)
+	clone.negative.counts = slices.Clone(s.negative.counts)
+	return &clone
+}
+
+// scaled returns the sketch of the readings divided by scale, which has to be a power of 10
+func (s *Sketch) scaled(scale float64) *Sketch {
+	shift := int(math.Round(math.Log10(scale) * sketchBucketsPerDecade))
+	scaled := *s
+	scaled.positive.offset -= shift
+	scaled.negative.offset -= shift
+	return &scaled
+}
+
+// sketchValue returns the value a bucket stands for, which is within the relative accuracy of all values in it
+func sketchValue(bucket int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(bucket)) / (sketchGamma + 1)
+}
+
+// sketchStore holds the counts of consecutive buckets, counts[i] being the count of bucket offset+i
+type sketchStore struct {
+	offset int
+	counts []uint64
+}
+
+func (st *sketchStore) add(bucket int, n uint64) {
+	if len(st.counts) == 0 {
+		st.offset = bucket
+		st.counts = make([]uint64, 1, 64)
+	}
+
+	if bucket < st.offset {
+		grown := make([]uint64, st.offset-bucket+len(st.counts), st.offset-bucket+cap(st.counts))
+		copy(grown[st.offset-bucket:], st.counts)
+		st.counts, st.offset = grown, bucket
+	}
+	for bucket-st.offset >= len(st.counts) {
+		st.counts = append(st.counts, 0)
+	}
+
+	st.counts[bucket-st.offset] += n
+}
+
+func (st *sketchStore) merge(other *sketchStore) {
+	for i, c := range other.counts {
+		if c > 0 {
+			st.add(other.offset+i, c)
+		}
+	}
+}
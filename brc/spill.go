@@ -0,0 +1,173 @@
+package brc
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// spillPartitions is the number of partitions the spilled stations are split into by their hash, every partition
+// is merged on its own so only a part of the stations is in memory at once
+const spillPartitions = 16
+
+// spillSeed partitions the stations of all chunks alike, unlike the seeds of the station tables
+var spillSeed = maphash.MakeSeed()
+
+func spillPartition(station string) int {
+	return int(maphash.String(spillSeed, station) % spillPartitions)
+}
+
+// spillRecord is a partial aggregate of a station in a spill file
+type spillRecord[T number] struct {
+	Station   string
+	Aggregate stationAggregate[T]
+}
+
+// spiller writes the stations of a chunk to partitioned temporary files once its table holds threshold stations,
+// emptying the table for the next stations. The first error is kept and stops spilling.
+type spiller[T number] struct {
+	threshold int
+	dir       string
+	files     []*os.File
+	writers   []*bufio.Writer
+	encoders  []*gob.Encoder
+	err       error
+}
+
+// newSpillers returns a spiller for every chunk, or nil when opts don't spill
+func newSpillers[T number](chunks int, opts Options) []*spiller[T] {
+	if opts.SpillStations == 0 {
+		return nil
+	}
+
+	spills := make([]*spiller[T], chunks)
+	for i := range spills {
+		spills[i] = &spiller[T]{threshold: opts.SpillStations, dir: opts.SpillDir}
+	}
+	return spills
+}
+
+func (s *spiller[T]) spilled() bool {
+	return s.files != nil
+}
+
+func (s *spiller[T]) spill(table *stationTable[stationAggregate[T]]) {
+	if s.err != nil {
+		return
+	}
+	if s.files == nil {
+		s.err = s.create()
+		if s.err != nil {
+			return
+		}
+	}
+
+	for i := range table.entries {
+		e := &table.entries[i]
+		s.err = s.encoders[spillPartition(e.key)].Encode(spillRecord[T]{e.key, e.value})
+		if s.err != nil {
+			s.err = fmt.Errorf("spilling stations failed: %w", s.err)
+			return
+		}
+	}
+	table.reset()
+}
+
+func (s *spiller[T]) create() error {
+	for range spillPartitions {
+		file, err := os.CreateTemp(s.dir, "brc-spill-*")
+		if err != nil {
+			return fmt.Errorf("creating spill file failed: %w", err)
+		}
+		w := bufio.NewWriter(file)
+		s.files = append(s.files, file)
+		s.writers = append(s.writers, w)
+		s.encoders = append(s.encoders, gob.NewEncoder(w))
+	}
+	return nil
+}
+
+// read calls add with every station spilled to partition
+func (s *spiller[T]) read(partition int, add func(string, *stationAggregate[T])) error {
+	err := s.writers[partition].Flush()
+	if err != nil {
+		return fmt.Errorf("spilling stations failed: %w", err)
+	}
+	file := s.files[partition]
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	dec := gob.NewDecoder(bufio.NewReader(file))
+	for {
+		var r spillRecord[T]
+		err := dec.Decode(&r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading spilled stations failed: %w", err)
+		}
+		add(r.Station, &r.Aggregate)
+	}
+}
+
+// close removes the spill files
+func (s *spiller[T]) close() {
+	for _, file := range s.files {
+		file.Close()
+		os.Remove(file.Name())
+	}
+}
+
+// mergeSpills merges the stations of the chunks partition by partition, from the spill files of the chunks which
+// spilled and the tables of the chunks which didn't. The results are sorted by name, as the partitions don't keep
+// the order the stations were first seen in.
+func mergeSpills[T number](chunkStations []map[string]*stationAggregate[T], spills []*spiller[T], scale float64, opts Options) ([]*StationResult, error) {
+	var results []*StationResult
+	for p := range spillPartitions {
+		stations := make(map[string]*stationAggregate[T])
+		var seen []string
+		add := func(station string, v *stationAggregate[T]) {
+			if s, ok := stations[station]; ok {
+				s.merge(v)
+				return
+			}
+			stations[station] = v
+			seen = append(seen, station)
+		}
+
+		for _, chunk := range chunkStations {
+			for station, v := range chunk {
+				if spillPartition(station) == p {
+					add(station, v)
+				}
+			}
+		}
+		for _, s := range spills {
+			if !s.spilled() {
+				continue
+			}
+			err := s.read(p, add)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		seen = filterStations(seen, opts.Stations)
+		results = append(results, collectResults(stations, seen, scale)...)
+	}
+
+	slices.SortFunc(results, func(a, b *StationResult) int {
+		return strings.Compare(a.Station, b.Station)
+	})
+	setPercentiles(results, opts.Percentiles)
+	return results, nil
+}
@@ -0,0 +1,129 @@
+package brc
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// maxDisplacement bounds the search for the displacement of a bucket, it is only reached by sets which can't be
+// hashed apart at all
+const maxDisplacement = 1 << 24
+
+// StationSet is a minimal perfect hash over a set of station names known in advance: every name of the set hashes to
+// its own index below the number of names, so looking up a station is a direct index and a compare of the name
+// instead of a probe sequence. Names outside the set hash to the index of some name of the set, which the compare
+// tells apart.
+//
+// The names are split into buckets by their StationHash, and every bucket gets the displacement which moves all of
+// its names to free indexes, starting with the biggest buckets while most indexes are still free.
+type StationSet struct {
+	names         []string // the names by their index
+	displacements []uint32 // the displacement of every bucket
+}
+
+// NewStationSet builds the perfect hash over names, which have to be distinct
+func NewStationSet(names []string) (*StationSet, error) {
+	if len(names) == 0 {
+		return nil, errors.New("the station set is empty")
+	}
+
+	hashes := make([]uint64, len(names))
+	seen := make(map[uint64]string, len(names))
+	for i, name := range names {
+		hashes[i] = StationHash([]byte(name))
+		if other, ok := seen[hashes[i]]; ok {
+			if other == name {
+				return nil, fmt.Errorf("station %q is in the set twice", name)
+			}
+			return nil, fmt.Errorf("stations %q and %q have the same hash", other, name)
+		}
+		seen[hashes[i]] = name
+	}
+
+	s := &StationSet{
+		names:         make([]string, len(names)),
+		displacements: make([]uint32, len(names)/2+1),
+	}
+	buckets := make([][]int, len(s.displacements))
+	for i, h := range hashes {
+		b := s.bucket(h)
+		buckets[b] = append(buckets[b], i)
+	}
+	order := make([]int, len(buckets))
+	for b := range order {
+		order[b] = b
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(len(buckets[b]), len(buckets[a]))
+	})
+
+	taken := make([]bool, len(names))
+	indexes := make([]uint32, 0, len(buckets[order[0]]))
+	for _, b := range order {
+		if len(buckets[b]) == 0 {
+			break
+		}
+
+		found := false
+		for d := uint32(0); d < maxDisplacement && !found; d++ {
+			indexes = indexes[:0]
+			found = true
+			for _, n := range buckets[b] {
+				i := s.index(hashes[n], d)
+				if taken[i] || slices.Contains(indexes, i) {
+					found = false
+					break
+				}
+				indexes = append(indexes, i)
+			}
+			if found {
+				s.displacements[b] = d
+			}
+		}
+		if !found {
+			return nil, errors.New("no perfect hash found for the station set")
+		}
+
+		for k, n := range buckets[b] {
+			taken[indexes[k]] = true
+			s.names[indexes[k]] = names[n]
+		}
+	}
+	return s, nil
+}
+
+// Len returns the number of stations in the set
+func (s *StationSet) Len() int {
+	return len(s.names)
+}
+
+// lookup returns the index of the station with the given name and StationHash, or -1 when it isn't in the set
+func (s *StationSet) lookup(name []byte, hash uint64) int {
+	i := s.index(hash, s.displacements[s.bucket(hash)])
+	if s.names[i] != string(name) {
+		return -1
+	}
+	return int(i)
+}
+
+// bucket picks the bucket of a hash. The bits of FNV-1a are mixed first, as similar names have similar high bits.
+func (s *StationSet) bucket(hash uint64) int {
+	return int(mixHash(hash) >> 32 * uint64(len(s.displacements)) >> 32)
+}
+
+func (s *StationSet) index(hash uint64, displacement uint32) uint32 {
+	x := mixHash(hash + uint64(displacement)*0x9e3779b97f4a7c15)
+	return uint32(x & 0xffffffff * uint64(len(s.names)) >> 32)
+}
+
+// mixHash is the finalizer of MurmurHash3, every bit of the result depending on every bit of x
+func mixHash(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
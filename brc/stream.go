@@ -0,0 +1,68 @@
+package brc
+
+import "slices"
+
+// Aggregation aggregates readings one at a time, for readings that don't come as lines of text like those pushed
+// over the network. It uses the same station table as ProcessInputs, combine the results of several aggregations
+// with Results.Merge. An Aggregation isn't safe for concurrent use.
+type Aggregation struct {
+	table *stationTable[stationAggregate[float64]]
+	extra extraStats
+	opts  Options
+}
+
+// NewAggregation returns an empty aggregation, of the options only the statistics, ExpectedStations, Stations,
+// Normalize and Rewrite apply
+func NewAggregation(opts Options) *Aggregation {
+	return &Aggregation{
+		table: newStationTable[stationAggregate[float64]](opts.ExpectedStations),
+		extra: newExtraStats(opts, 1),
+		opts:  opts,
+	}
+}
+
+// Add aggregates a reading of station
+func (a *Aggregation) Add(station []byte, reading float64) {
+	v, inserted := a.table.get(station)
+	if inserted {
+		*v = stationAggregate[float64]{Min: reading, Max: reading, Sum: reading, Readings: 1}
+	} else {
+		if v.Min > reading {
+			v.Min = reading
+		} else if v.Max < reading {
+			v.Max = reading
+		}
+		v.Sum += reading
+		v.Readings += 1
+	}
+	if a.extra.any() {
+		addExtra(v, reading, a.extra)
+	}
+}
+
+// Results returns the results of the readings added so far, in the order the stations were first added
+func (a *Aggregation) Results() Results {
+	stations := make(map[string]*stationAggregate[float64], len(a.table.entries))
+	seen := make([]string, 0, len(a.table.entries))
+	for i := range a.table.entries {
+		e := &a.table.entries[i]
+		// a copy, so adding more readings doesn't change the returned results
+		v := e.value
+		if v.Sketch != nil {
+			v.Sketch = v.Sketch.clone()
+		}
+		v.Histogram = slices.Clone(v.Histogram)
+		v.Custom = cloneCustom(v.Custom, a.extra.custom)
+		stations[e.key] = &v
+		seen = append(seen, e.key)
+	}
+
+	if rename := a.opts.rename(); rename != nil {
+		stations, seen = rewriteStations(stations, seen, rename)
+	}
+	seen = filterStations(seen, a.opts.Stations)
+
+	results := collectResults(stations, seen, 1)
+	setPercentiles(results, a.opts.Percentiles)
+	return Results{Stations: results}
+}
@@ -0,0 +1,65 @@
+package brc
+
+import "testing"
+
+// countAggregator counts the readings of a station
+type countAggregator struct {
+	n int
+}
+
+func (c *countAggregator) Observe(tempTenths int) {
+	c.n++
+}
+
+func (c *countAggregator) Merge(other Aggregator) {
+	c.n += other.(*countAggregator).n
+}
+
+func (c *countAggregator) Result() any {
+	return c.n
+}
+
+func TestAggregationResultsTwice(t *testing.T) {
+	rewrite, err := ParseRewrite(`-\d+$=>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAggregation(Options{
+		Rewrite:     rewrite,
+		Aggregators: []CustomAggregator{{"count", func() Aggregator { return &countAggregator{} }}},
+	})
+	a.Add([]byte("Paris-01"), 10)
+	a.Add([]byte("Paris-02"), 20)
+	a.Add([]byte("Paris-02"), 30)
+
+	for i := range 2 {
+		results := a.Results()
+		if len(results.Stations) != 1 {
+			t.Fatalf("call %d: expected 1 station, got %d", i+1, len(results.Stations))
+		}
+		s := results.Stations[0]
+		if s.Readings != 3 {
+			t.Errorf("call %d: expected 3 readings, got %d", i+1, s.Readings)
+		}
+		if count := s.Aggregators["count"].Result(); count != 3 {
+			t.Errorf("call %d: expected the custom aggregator to count 3 readings, got %v", i+1, count)
+		}
+	}
+}
+
+func TestAggregationResultsAreCopies(t *testing.T) {
+	a := NewAggregation(Options{
+		Aggregators: []CustomAggregator{{"count", func() Aggregator { return &countAggregator{} }}},
+	})
+	a.Add([]byte("Paris"), 10)
+	results := a.Results()
+	a.Add([]byte("Paris"), 20)
+
+	s := results.Stations[0]
+	if s.Readings != 1 || s.Max != 10 {
+		t.Errorf("expected the results of the first reading, got %+v", *s)
+	}
+	if count := s.Aggregators["count"].Result(); count != 1 {
+		t.Errorf("expected the custom aggregator to count 1 reading, got %v", count)
+	}
+}
@@ -0,0 +1,111 @@
+package brc
+
+// stationTable is an open addressing hash table keyed by the raw bytes of the station name, the name is only copied
+// into a string when a new station is inserted. Entries are kept in insertion order.
+// With a StationSet the slots are the indexes of the set instead, and stations outside of it aren't inserted.
+type stationTable[V any] struct {
+	slots   []int32 // index into entries plus one, zero being an empty slot
+	entries []tableEntry[V]
+	set     *StationSet
+	resizes int // number of times the slots grew, for MapStats
+}
+
+type tableEntry[V any] struct {
+	hash  uint64
+	key   string
+	value V
+}
+
+func newStationTable[V any](expectedStations int) *stationTable[V] {
+	size := 1024
+	for size < expectedStations*2 {
+		size <<= 1
+	}
+
+	return &stationTable[V]{
+		slots:   make([]int32, size),
+		entries: make([]tableEntry[V], 0, expectedStations),
+	}
+}
+
+// newChunkTable returns the station table a chunk is read into, over the StationSet of opts when there is one
+func newChunkTable[V any](opts Options) *stationTable[V] {
+	if opts.StationSet == nil {
+		return newStationTable[V](opts.ExpectedStations)
+	}
+
+	return &stationTable[V]{
+		slots:   make([]int32, opts.StationSet.Len()),
+		entries: make([]tableEntry[V], 0, opts.StationSet.Len()),
+		set:     opts.StationSet,
+	}
+}
+
+// get returns the value of key, inserting a zero value first when the key isn't in the table yet. The returned
+// pointer is only valid until the next insert. With a StationSet it is nil for a key outside of the set.
+func (t *stationTable[V]) get(key []byte) (v *V, inserted bool) {
+	return t.getHash(key, StationHash(key))
+}
+
+// getHash is get for a key of which the StationHash is known already
+func (t *stationTable[V]) getHash(key []byte, hash uint64) (v *V, inserted bool) {
+	if t.set != nil {
+		return t.getSet(key, hash)
+	}
+
+	mask := uint64(len(t.slots) - 1)
+	for i := hash & mask; ; i = (i + 1) & mask {
+		slot := t.slots[i]
+		if slot == 0 {
+			t.entries = append(t.entries, tableEntry[V]{hash: hash, key: string(key)})
+			t.slots[i] = int32(len(t.entries))
+			v = &t.entries[len(t.entries)-1].value
+
+			// keep the load factor at most one half so probe sequences stay short
+			if len(t.entries)*2 > len(t.slots) {
+				t.grow()
+			}
+			return v, true
+		}
+
+		e := &t.entries[slot-1]
+		if e.hash == hash && e.key == string(key) {
+			return &e.value, false
+		}
+	}
+}
+
+// getSet is getHash over the StationSet, which never grows as the set holds all stations there can be
+func (t *stationTable[V]) getSet(key []byte, hash uint64) (v *V, inserted bool) {
+	i := t.set.lookup(key, hash)
+	if i < 0 {
+		return nil, false
+	}
+
+	if slot := t.slots[i]; slot != 0 {
+		return &t.entries[slot-1].value, false
+	}
+	t.entries = append(t.entries, tableEntry[V]{hash: hash, key: t.set.names[i]})
+	t.slots[i] = int32(len(t.entries))
+	return &t.entries[len(t.entries)-1].value, true
+}
+
+func (t *stationTable[V]) grow() {
+	t.resizes++
+	t.slots = make([]int32, len(t.slots)*2)
+	mask := uint64(len(t.slots) - 1)
+	for n, e := range t.entries {
+		i := e.hash & mask
+		for t.slots[i] != 0 {
+			i = (i + 1) & mask
+		}
+		t.slots[i] = int32(n + 1)
+	}
+}
+
+// reset empties the table, keeping its memory for the stations inserted next
+func (t *stationTable[V]) reset() {
+	clear(t.slots)
+	clear(t.entries)
+	t.entries = t.entries[:0]
+}
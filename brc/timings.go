@@ -0,0 +1,99 @@
+package brc
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Timings breaks down where the time of processing went, it is filled in while processing when set in the Options
+type Timings struct {
+	read      atomic.Int64
+	aggregate time.Duration
+	merge     time.Duration
+	chunks    []ChunkTiming
+}
+
+// ChunkTiming is the number of lines read from a single chunk and the time it took to read and parse them
+type ChunkTiming struct {
+	Rows int
+	Time time.Duration
+}
+
+// Read returns the time spent waiting for reads, summed over all chunks. The chunks are read in parallel, so it can
+// exceed the wall time. Memory mapped files aren't read explicitly and take no read time.
+func (t *Timings) Read() time.Duration {
+	return time.Duration(t.read.Load())
+}
+
+// Aggregate returns the wall time of reading and parsing all chunks, reading and parsing overlap
+func (t *Timings) Aggregate() time.Duration {
+	return t.aggregate
+}
+
+// Merge returns the wall time of merging the stations of the chunks and collecting the results
+func (t *Timings) Merge() time.Duration {
+	return t.merge
+}
+
+// Chunks returns the timing of every chunk, in the order of the chunks. The chunks are read by separate workers.
+func (t *Timings) Chunks() []ChunkTiming {
+	return t.chunks
+}
+
+// Rows returns the number of lines read from all chunks
+func (t *Timings) Rows() int {
+	rows := 0
+	for _, c := range t.chunks {
+		rows += c.Rows
+	}
+	return rows
+}
+
+func (t *Timings) startChunks(n int) {
+	if t != nil {
+		t.chunks = make([]ChunkTiming, n)
+	}
+}
+
+// chunkRead records the timing of chunk i, every chunk is recorded by its own goroutine
+func (t *Timings) chunkRead(i int, start time.Time, rows int) {
+	if t != nil {
+		t.chunks[i] = ChunkTiming{rows, time.Since(start)}
+	}
+}
+
+func (t *Timings) aggregated(start time.Time) time.Time {
+	now := time.Now()
+	if t != nil {
+		t.aggregate = now.Sub(start)
+	}
+	return now
+}
+
+func (t *Timings) merged(start time.Time) {
+	if t != nil {
+		t.merge = time.Since(start)
+	}
+}
+
+// timedReader adds the time spent in the reads of r to the timings
+type timedReader struct {
+	r       io.Reader
+	timings *Timings
+}
+
+func (t *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.r.Read(p)
+	t.timings.read.Add(int64(time.Since(start)))
+	return n, err
+}
+
+// timeReads wraps r to time its reads when timings is set
+func timeReads(r io.Reader, timings *Timings) io.Reader {
+	if timings == nil {
+		return r
+	}
+	return &timedReader{r, timings}
+}
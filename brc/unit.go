@@ -0,0 +1,68 @@
+package brc
+
+// Unit is a temperature scale the results can be converted between
+type Unit int
+
+const (
+	Celsius    Unit = iota // the unit of the challenge
+	Fahrenheit             // degrees Celsius times 1.8 plus 32
+	Kelvin                 // degrees Celsius plus 273.15
+)
+
+// fromCelsius returns the factor and offset converting degrees Celsius to the unit
+func (u Unit) fromCelsius() (float64, float64) {
+	switch u {
+	case Fahrenheit:
+		return 1.8, 32
+	case Kelvin:
+		return 1, 273.15
+	default:
+		return 1, 0
+	}
+}
+
+// Convert returns a copy of the results with the readings of every station converted from one unit to another. The
+// min, mean, max, sum, standard deviation, sum of squares, percentiles and value columns are converted, the
+// histograms, sketches and custom aggregators are left in the original unit. Converted results are meant to be
+// written rather than merged with results in the original unit.
+func (r Results) Convert(from Unit, to Unit) Results {
+	if from == to {
+		return r
+	}
+
+	// x in from is (x-fromOffset)/fromFactor in Celsius, which is a*x+b in to
+	fromFactor, fromOffset := from.fromCelsius()
+	toFactor, toOffset := to.fromCelsius()
+	a := toFactor / fromFactor
+	b := toOffset - fromOffset*a
+	convert := func(x float64) float64 {
+		return a*x + b
+	}
+
+	stations := make([]*StationResult, len(r.Stations))
+	for i, s := range r.Stations {
+		converted := *s
+		n := float64(s.Readings)
+		converted.Min, converted.Mean, converted.Max = convert(s.Min), convert(s.Mean), convert(s.Max)
+		converted.Sum = a*s.Sum + b*n
+		converted.StdDev = a * s.StdDev
+		if s.SumSquares != 0 {
+			converted.SumSquares = a*a*s.SumSquares + 2*a*b*s.Sum + b*b*n
+		}
+		if s.Percentiles != nil {
+			converted.Percentiles = make([]Percentile, len(s.Percentiles))
+			for i, p := range s.Percentiles {
+				converted.Percentiles[i] = Percentile{p.Quantile, convert(p.Value)}
+			}
+		}
+		if s.Columns != nil {
+			converted.Columns = make([]ColumnResult, len(s.Columns))
+			for c, column := range s.Columns {
+				converted.Columns[c] = ColumnResult{column.Column, convert(column.Min), convert(column.Max), convert(column.Mean), a*column.Sum + b*n}
+			}
+		}
+		stations[i] = &converted
+	}
+
+	return Results{stations, r.Skipped, r.Excluded}
+}
@@ -0,0 +1,124 @@
+package brc
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseReading parses a single reading with the parser of opts, the way ProcessInputs parses the readings of every line
+func ParseReading(b []byte, opts Options) (float64, bool) {
+	switch {
+	case opts.Parser == ParseFloat && opts.DecimalComma:
+		return parseFloatComma(b)
+	case opts.Parser == ParseFloat:
+		return parseFloat(b)
+	case opts.Parser == ParseInt:
+		n, ok := parseInt(b)
+		return float64(n), ok
+	case opts.DecimalComma:
+		n, ok := parseTenthsComma(b)
+		return float64(n) / 10, ok
+	default:
+		n, ok := parseTenths(b)
+		return float64(n) / 10, ok
+	}
+}
+
+// maxExactTenths is the largest reading of which the tenths still convert to a float64 exactly, the fixed parser
+// rounds larger readings twice
+const maxExactTenths = 1 << 53 / 10
+
+// VerifyReading compares ParseReading with strconv.ParseFloat on b. A reading the parser accepts has to parse to
+// the same value with strconv, and a plain decimal in the format of the parser has to be accepted. The parsers
+// may reject what only strconv accepts, like exponents or infinity. Readings of the fixed parser beyond
+// maxExactTenths are only checked to be accepted.
+func VerifyReading(b []byte, opts Options) error {
+	got, ok := ParseReading(b, opts)
+
+	s := string(b)
+	point := byte('.')
+	if opts.DecimalComma {
+		point = ','
+		if strings.ContainsRune(s, '.') {
+			s = "invalid" // a decimal point isn't a decimal comma
+		}
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	want, err := strconv.ParseFloat(s, 64)
+
+	switch {
+	case ok && err != nil:
+		return fmt.Errorf("reading %q parsed as %v, strconv rejects it", b, got)
+	case ok && got != want && (opts.Parser != ParseFixed || math.Abs(want) <= maxExactTenths):
+		return fmt.Errorf("reading %q parsed as %v, strconv parses it as %v", b, got, want)
+	case !ok && err == nil && plainDecimal(b, point, opts.Parser):
+		return fmt.Errorf("reading %q rejected, strconv parses it as %v", b, want)
+	}
+	return nil
+}
+
+// plainDecimal returns whether b is a decimal the parser has to accept: an optional sign and digits, with a
+// fraction after the point for the float parser and a single fractional digit for the fixed parser. The integer
+// parsers only take 18 digits.
+func plainDecimal(b []byte, point byte, parser Parser) bool {
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		b = b[1:]
+	}
+	integer, fraction, hasPoint := strings.Cut(string(b), string(point))
+	if !digits(integer) || !digits(fraction) {
+		return false
+	}
+
+	switch parser {
+	case ParseFloat:
+		return integer != "" || fraction != ""
+	case ParseInt:
+		return !hasPoint && integer != "" && len(integer) <= 18
+	default:
+		return integer != "" && len(integer) <= 17 && (!hasPoint || len(fraction) == 1)
+	}
+}
+
+// digits returns whether s only holds ASCII digits, an empty s does too
+func digits(s string) bool {
+	for i := range len(s) {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyLines verifies the reading of every line with VerifyReading, stopping with the error of the first mismatch
+type verifyLines struct {
+	lineScanner
+	opts Options
+	err  error
+}
+
+func (v *verifyLines) Scan() bool {
+	if v.err != nil || !v.lineScanner.Scan() {
+		return false
+	}
+
+	line := v.Bytes()
+	i := indexByte(line, v.opts.separator())
+	if i < 0 {
+		return true // the line is malformed, which the aggregation handles
+	}
+	err := VerifyReading(line[i+1:], v.opts)
+	if err != nil {
+		v.err = fmt.Errorf("verifying the parser failed: %w", err)
+		return false
+	}
+	return true
+}
+
+func (v *verifyLines) Err() error {
+	if v.err != nil {
+		return v.err
+	}
+	return v.lineScanner.Err()
+}
@@ -0,0 +1,376 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: brc.proto
+
+package brcpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Reading struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Station       string                 `protobuf:"bytes,1,opt,name=station,proto3" json:"station,omitempty"`
+	Temperature   float64                `protobuf:"fixed64,2,opt,name=temperature,proto3" json:"temperature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Reading) Reset() {
+	*x = Reading{}
+	mi := &file_brc_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Reading) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reading) ProtoMessage() {}
+
+func (x *Reading) ProtoReflect() protoreflect.Message {
+	mi := &file_brc_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reading.ProtoReflect.Descriptor instead.
+func (*Reading) Descriptor() ([]byte, []int) {
+	return file_brc_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Reading) GetStation() string {
+	if x != nil {
+		return x.Station
+	}
+	return ""
+}
+
+func (x *Reading) GetTemperature() float64 {
+	if x != nil {
+		return x.Temperature
+	}
+	return 0
+}
+
+type IngestSummary struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// the number of readings of the stream
+	Readings      int64 `protobuf:"varint,1,opt,name=readings,proto3" json:"readings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestSummary) Reset() {
+	*x = IngestSummary{}
+	mi := &file_brc_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestSummary) ProtoMessage() {}
+
+func (x *IngestSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_brc_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestSummary.ProtoReflect.Descriptor instead.
+func (*IngestSummary) Descriptor() ([]byte, []int) {
+	return file_brc_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *IngestSummary) GetReadings() int64 {
+	if x != nil {
+		return x.Readings
+	}
+	return 0
+}
+
+type ResultsFilter struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// the names of the only stations to return, all stations when empty
+	Stations      []string `protobuf:"bytes,1,rep,name=stations,proto3" json:"stations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResultsFilter) Reset() {
+	*x = ResultsFilter{}
+	mi := &file_brc_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResultsFilter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResultsFilter) ProtoMessage() {}
+
+func (x *ResultsFilter) ProtoReflect() protoreflect.Message {
+	mi := &file_brc_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResultsFilter.ProtoReflect.Descriptor instead.
+func (*ResultsFilter) Descriptor() ([]byte, []int) {
+	return file_brc_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ResultsFilter) GetStations() []string {
+	if x != nil {
+		return x.Stations
+	}
+	return nil
+}
+
+type StationResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Station       string                 `protobuf:"bytes,1,opt,name=station,proto3" json:"station,omitempty"`
+	Min           float64                `protobuf:"fixed64,2,opt,name=min,proto3" json:"min,omitempty"`
+	Mean          float64                `protobuf:"fixed64,3,opt,name=mean,proto3" json:"mean,omitempty"`
+	Max           float64                `protobuf:"fixed64,4,opt,name=max,proto3" json:"max,omitempty"`
+	Count         int64                  `protobuf:"varint,5,opt,name=count,proto3" json:"count,omitempty"`
+	Sum           float64                `protobuf:"fixed64,6,opt,name=sum,proto3" json:"sum,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StationResult) Reset() {
+	*x = StationResult{}
+	mi := &file_brc_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StationResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StationResult) ProtoMessage() {}
+
+func (x *StationResult) ProtoReflect() protoreflect.Message {
+	mi := &file_brc_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StationResult.ProtoReflect.Descriptor instead.
+func (*StationResult) Descriptor() ([]byte, []int) {
+	return file_brc_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *StationResult) GetStation() string {
+	if x != nil {
+		return x.Station
+	}
+	return ""
+}
+
+func (x *StationResult) GetMin() float64 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *StationResult) GetMean() float64 {
+	if x != nil {
+		return x.Mean
+	}
+	return 0
+}
+
+func (x *StationResult) GetMax() float64 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+func (x *StationResult) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *StationResult) GetSum() float64 {
+	if x != nil {
+		return x.Sum
+	}
+	return 0
+}
+
+type StationResults struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stations      []*StationResult       `protobuf:"bytes,1,rep,name=stations,proto3" json:"stations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StationResults) Reset() {
+	*x = StationResults{}
+	mi := &file_brc_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StationResults) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StationResults) ProtoMessage() {}
+
+func (x *StationResults) ProtoReflect() protoreflect.Message {
+	mi := &file_brc_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StationResults.ProtoReflect.Descriptor instead.
+func (*StationResults) Descriptor() ([]byte, []int) {
+	return file_brc_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StationResults) GetStations() []*StationResult {
+	if x != nil {
+		return x.Stations
+	}
+	return nil
+}
+
+var File_brc_proto protoreflect.FileDescriptor
+
+const file_brc_proto_rawDesc = "" +
+	"\n" +
+	"\tbrc.proto\x12\x06brc.v1\"E\n" +
+	"\aReading\x12\x18\n" +
+	"\astation\x18\x01 \x01(\tR\astation\x12 \n" +
+	"\vtemperature\x18\x02 \x01(\x01R\vtemperature\"+\n" +
+	"\rIngestSummary\x12\x1a\n" +
+	"\breadings\x18\x01 \x01(\x03R\breadings\"+\n" +
+	"\rResultsFilter\x12\x1a\n" +
+	"\bstations\x18\x01 \x03(\tR\bstations\"\x89\x01\n" +
+	"\rStationResult\x12\x18\n" +
+	"\astation\x18\x01 \x01(\tR\astation\x12\x10\n" +
+	"\x03min\x18\x02 \x01(\x01R\x03min\x12\x12\n" +
+	"\x04mean\x18\x03 \x01(\x01R\x04mean\x12\x10\n" +
+	"\x03max\x18\x04 \x01(\x01R\x03max\x12\x14\n" +
+	"\x05count\x18\x05 \x01(\x03R\x05count\x12\x10\n" +
+	"\x03sum\x18\x06 \x01(\x01R\x03sum\"C\n" +
+	"\x0eStationResults\x121\n" +
+	"\bstations\x18\x01 \x03(\v2\x15.brc.v1.StationResultR\bstations2}\n" +
+	"\n" +
+	"Aggregator\x122\n" +
+	"\x06Ingest\x12\x0f.brc.v1.Reading\x1a\x15.brc.v1.IngestSummary(\x01\x12;\n" +
+	"\n" +
+	"GetResults\x12\x15.brc.v1.ResultsFilter\x1a\x16.brc.v1.StationResultsB\x1aZ\x18beruzebabu/go_1brc/brcpbb\x06proto3"
+
+var (
+	file_brc_proto_rawDescOnce sync.Once
+	file_brc_proto_rawDescData []byte
+)
+
+func file_brc_proto_rawDescGZIP() []byte {
+	file_brc_proto_rawDescOnce.Do(func() {
+		file_brc_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_brc_proto_rawDesc), len(file_brc_proto_rawDesc)))
+	})
+	return file_brc_proto_rawDescData
+}
+
+var file_brc_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_brc_proto_goTypes = []any{
+	(*Reading)(nil),        // 0: brc.v1.Reading
+	(*IngestSummary)(nil),  // 1: brc.v1.IngestSummary
+	(*ResultsFilter)(nil),  // 2: brc.v1.ResultsFilter
+	(*StationResult)(nil),  // 3: brc.v1.StationResult
+	(*StationResults)(nil), // 4: brc.v1.StationResults
+}
+var file_brc_proto_depIdxs = []int32{
+	3, // 0: brc.v1.StationResults.stations:type_name -> brc.v1.StationResult
+	0, // 1: brc.v1.Aggregator.Ingest:input_type -> brc.v1.Reading
+	2, // 2: brc.v1.Aggregator.GetResults:input_type -> brc.v1.ResultsFilter
+	1, // 3: brc.v1.Aggregator.Ingest:output_type -> brc.v1.IngestSummary
+	4, // 4: brc.v1.Aggregator.GetResults:output_type -> brc.v1.StationResults
+	3, // [3:5] is the sub-list for method output_type
+	1, // [1:3] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_brc_proto_init() }
+func file_brc_proto_init() {
+	if File_brc_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_brc_proto_rawDesc), len(file_brc_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_brc_proto_goTypes,
+		DependencyIndexes: file_brc_proto_depIdxs,
+		MessageInfos:      file_brc_proto_msgTypes,
+	}.Build()
+	File_brc_proto = out.File
+	file_brc_proto_goTypes = nil
+	file_brc_proto_depIdxs = nil
+}
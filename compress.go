@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	parquetMagic = []byte("PAR1")
+)
+
+// decompress returns a reader of the decompressed contents of file, so compressed files don't need to be
+// decompressed to disk first. With compression auto the format is picked by the extension of the file and
+// otherwise by its magic bytes. Uncompressed regular files are returned as is to keep them splittable.
+func decompress(file *os.File, compression string) (io.Reader, error) {
+	if !isRegular(file) {
+		return decompressStream(file, file.Name(), compression)
+	}
+
+	magic := make([]byte, len(zstdMagic))
+	n, _ := file.ReadAt(magic, 0)
+	return decompressMagic(file, file.Name(), magic[:n], compression)
+}
+
+// decompressStream is decompress for streams like pipes and remote files, which can't be read twice. It peeks at
+// the start instead, name is only used for its extension.
+func decompressStream(r io.Reader, name string, compression string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	return decompressMagic(br, name, magic, compression)
+}
+
+func decompressMagic(r io.Reader, name string, magic []byte, compression string) (io.Reader, error) {
+	if compression == "auto" {
+		compression = detectCompression(name, magic)
+	}
+
+	switch compression {
+	case "gzip":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("opening gzip stream failed: %w", err)
+		}
+		return gr, nil
+	case "zstd":
+		// decoding blocks concurrently keeps up with the aggregation, which otherwise waits on a single decoder
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(0))
+		if err != nil {
+			return nil, fmt.Errorf("opening zstd stream failed: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return r, nil
+	}
+}
+
+func detectCompression(name string, magic []byte) string {
+	switch {
+	case filepath.Ext(name) == ".gz" || bytes.HasPrefix(magic, gzipMagic):
+		return "gzip"
+	case filepath.Ext(name) == ".zst" || bytes.HasPrefix(magic, zstdMagic):
+		return "zstd"
+	default:
+		return "none"
+	}
+}
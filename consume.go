@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// consumeBatchSize is the size of the lines buffered before they are aggregated, also when the interval hasn't
+// passed yet
+const consumeBatchSize = 4 * 1024 * 1024
+
+type ConsumeFlags struct {
+	Brokers  []string
+	Topic    string
+	Group    string
+	Interval time.Duration
+	Parser   string
+	OutputFlags
+}
+
+func parseConsumeFlags(args []string) (ConsumeFlags, error) {
+	fs := flag.NewFlagSet("consume", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go_1brc consume -brokers localhost:9092 -topic measurements [flags]")
+		fs.PrintDefaults()
+	}
+	brokers := fs.String("brokers", "localhost:9092", "comma separated addresses of the Kafka brokers")
+	topic := fs.String("topic", "", "topic to consume, every record is a station;temp line")
+	group := fs.String("group", "go_1brc", "consumer group to join, its partitions are shared with the other consumers of the group and a new group starts at the oldest record")
+	interval := fs.Duration("interval", 10*time.Second, "how often a snapshot of the running results is written, when they changed")
+	parser := fs.String("parser", "fixed", "how readings are parsed: fixed or float")
+	outputFlags := registerOutputFlags(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return ConsumeFlags{}, err
+	}
+
+	if *topic == "" {
+		return ConsumeFlags{}, errors.New("no topic specified")
+	}
+	if *brokers == "" || *group == "" {
+		return ConsumeFlags{}, errors.New("-brokers and -group can't be empty")
+	}
+	if *interval <= 0 {
+		return ConsumeFlags{}, errors.New("-interval must be positive")
+	}
+	if *parser != "fixed" && *parser != "float" {
+		return ConsumeFlags{}, fmt.Errorf("unknown parser %q", *parser)
+	}
+
+	output, err := outputFlags()
+	if err != nil {
+		return ConsumeFlags{}, err
+	}
+
+	return ConsumeFlags{strings.Split(*brokers, ","), *topic, *group, *interval, *parser, output}, nil
+}
+
+// runConsume aggregates the records of a Kafka topic as they arrive until SIGINT or SIGTERM, every record being a
+// line of measurements. The records are aggregated in batches and merged into the running results, a snapshot of
+// which is written every interval. Malformed records are skipped and counted.
+func runConsume(args []string) error {
+	flags, err := parseConsumeFlags(args)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	opts := brc.Options{Workers: 1, OnError: brc.ErrorsSkip}
+	if flags.Parser == "float" {
+		opts.Parser = brc.ParseFloat
+	}
+	outputFlags := CliFlags{OutputFlags: flags.OutputFlags, Order: "sorted", Sort: "name"}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: flags.Brokers, Topic: flags.Topic, GroupID: flags.Group})
+	defer reader.Close()
+	log.Println("consuming", flags.Topic, "from", strings.Join(flags.Brokers, ", "))
+
+	records := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := reader.ReadMessage(ctx)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case records <- msg.Value:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var results brc.Results
+	var batch bytes.Buffer
+	aggregate := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		part, err := brc.ProcessInputs([]io.Reader{&batch}, opts)
+		if err != nil {
+			return err
+		}
+		results.Merge(part)
+		batch.Reset()
+		return nil
+	}
+
+	changed := false
+	snapshots := time.NewTicker(flags.Interval)
+	defer snapshots.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("stopped consuming, writing the final results")
+			err = aggregate()
+			if err != nil {
+				return err
+			}
+			return writeSnapshot(results, outputFlags, start)
+		case err := <-readErr:
+			if ctx.Err() != nil {
+				continue // stopped while reading, the results are written above
+			}
+			return fmt.Errorf("consuming %s failed: %w", flags.Topic, err)
+		case record := <-records:
+			batch.Write(bytes.TrimRight(record, "\r\n"))
+			batch.WriteByte('\n')
+			changed = true
+			if batch.Len() >= consumeBatchSize {
+				err = aggregate()
+				if err != nil {
+					return err
+				}
+			}
+		case <-snapshots.C:
+			if !changed {
+				continue
+			}
+			err = aggregate()
+			if err != nil {
+				return err
+			}
+			log.Println("aggregated", len(results.Stations), "stations, skipped", results.Skipped, "malformed records", time.Since(start))
+			err = writeSnapshot(results, outputFlags, start)
+			if err != nil {
+				return err
+			}
+			changed = false
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+type DiffFlags struct {
+	A, B      string
+	Tolerance float64
+}
+
+func parseDiffFlags(args []string) (DiffFlags, error) {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go_1brc diff [flags] a.out b.out")
+		fs.PrintDefaults()
+	}
+	tolerance := fs.Float64("tolerance", 0, "largest difference between the min, mean or max of a station in both files that still counts as equal")
+	err := fs.Parse(args)
+	if err != nil {
+		return DiffFlags{}, err
+	}
+
+	if fs.NArg() != 2 {
+		return DiffFlags{}, errors.New("diff needs exactly two result files")
+	}
+	if *tolerance < 0 || math.IsNaN(*tolerance) {
+		return DiffFlags{}, errors.New("-tolerance can't be negative")
+	}
+
+	return DiffFlags{fs.Arg(0), fs.Arg(1), *tolerance}, nil
+}
+
+// runDiff compares two result files, in the output format of the challenge or json, and reports the stations only
+// in one of them and the stations whose min, mean or max differ by more than the tolerance
+func runDiff(args []string) error {
+	flags, err := parseDiffFlags(args)
+	if err != nil {
+		return err
+	}
+
+	a, err := readResultsFile(flags.A)
+	if err != nil {
+		return err
+	}
+	b, err := readResultsFile(flags.B)
+	if err != nil {
+		return err
+	}
+
+	differences := diffResults(os.Stdout, a, b, flags.A, flags.B, flags.Tolerance)
+	if differences > 0 {
+		return fmt.Errorf("%d stations differ", differences)
+	}
+	fmt.Println("all", len(a.Stations), "stations are equal")
+	return nil
+}
+
+// readResultsFile reads results written in the output format of the challenge, with -format json or with
+// brc.Results.MarshalJSON. Only the min, mean and max of the stations are read.
+func readResultsFile(path string) (brc.Results, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return brc.Results{}, fmt.Errorf("reading results failed: %w", err)
+	}
+
+	var results brc.Results
+	switch data = bytes.TrimSpace(data); {
+	case bytes.HasPrefix(data, []byte("[")):
+		var stations []jsonStation
+		err = json.Unmarshal(data, &stations)
+		for _, s := range stations {
+			if s.Min == nil || s.Mean == nil || s.Max == nil {
+				return brc.Results{}, fmt.Errorf("%s: %s lacks the min, mean or max, write the results without -agg or include them", path, s.Station)
+			}
+			results.Stations = append(results.Stations, &brc.StationResult{Station: s.Station, Min: *s.Min, Mean: *s.Mean, Max: *s.Max})
+		}
+	case json.Valid(data):
+		err = json.Unmarshal(data, &results)
+	default:
+		err = results.UnmarshalText(data)
+	}
+	if err != nil {
+		return brc.Results{}, fmt.Errorf("%s: decoding results failed: %w", path, err)
+	}
+	return results, nil
+}
+
+// diffResults writes a line to w for every station only in a or b and every station whose statistics differ by more
+// than tolerance, in the order of a and then b. It returns the number of such stations.
+func diffResults(w io.Writer, a, b brc.Results, nameA, nameB string, tolerance float64) int {
+	inB := make(map[string]*brc.StationResult, len(b.Stations))
+	for _, s := range b.Stations {
+		inB[s.Station] = s
+	}
+
+	differences := 0
+	inA := make(map[string]bool, len(a.Stations))
+	for _, sa := range a.Stations {
+		inA[sa.Station] = true
+		sb, ok := inB[sa.Station]
+		if !ok {
+			fmt.Fprintf(w, "%s: only in %s\n", sa.Station, nameA)
+			differences++
+			continue
+		}
+
+		statsA := []float64{sa.Min, sa.Mean, sa.Max}
+		statsB := []float64{sb.Min, sb.Mean, sb.Max}
+		// the slack keeps a difference of exactly the tolerance equal, like 0.1 between 15.1 and 15.0
+		if slices.EqualFunc(statsA, statsB, func(x, y float64) bool { return math.Abs(x-y) <= tolerance+1e-9 }) {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %.1f/%.1f/%.1f in %s, %.1f/%.1f/%.1f in %s\n", sa.Station, sa.Min, sa.Mean, sa.Max, nameA, sb.Min, sb.Mean, sb.Max, nameB)
+		differences++
+	}
+
+	for _, sb := range b.Stations {
+		if !inA[sb.Station] {
+			fmt.Fprintf(w, "%s: only in %s\n", sb.Station, nameB)
+			differences++
+		}
+	}
+	return differences
+}
+
+// checkExpected compares the results written in the output format of the challenge, sorted by name, with the
+// expected output at path, like the output of the Java baseline. When they differ the stations that differ are
+// written to w, or the first byte that differs when the statistics are the same but written differently.
+func checkExpected(w io.Writer, results brc.Results, intValues bool, path string) error {
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading the expected output failed: %w", err)
+	}
+
+	results.Stations = slices.Clone(results.Stations)
+	results.Sort()
+	results = results.Rounded()
+	var output bytes.Buffer
+	err = writeResults(&output, results.Stations, intValues, defaultAggregations("brc"))
+	if err != nil {
+		return err
+	}
+	got, expected := bytes.TrimSpace(output.Bytes()), bytes.TrimSpace(expected)
+	if bytes.Equal(got, expected) {
+		return nil
+	}
+
+	want, err := readResultsFile(path)
+	if err != nil {
+		return err
+	}
+	differences := diffResults(w, want, results, path, "the results", 0)
+	if differences > 0 {
+		return fmt.Errorf("%d stations differ from %s", differences, path)
+	}
+
+	i := 0
+	for i < len(got) && i < len(expected) && got[i] == expected[i] {
+		i++
+	}
+	from := max(i-20, 0)
+	fmt.Fprintf(w, "the output differs at byte %d: expected %q, got %q\n", i, expected[from:min(i+20, len(expected))], got[from:min(i+20, len(got))])
+	return fmt.Errorf("the output differs from %s", path)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// followPollInterval is how often a followed file is checked for appended lines
+const followPollInterval = 200 * time.Millisecond
+
+// followFile aggregates the file like tail -f: once its lines are processed it keeps polling for appended lines and
+// merges them into the running results. A snapshot of the results is written every interval when they changed, and
+// once more when ctx is done. Only complete lines are processed, a line still being written is picked up once its
+// newline is.
+func followFile(ctx context.Context, path string, flags CliFlags) error {
+	log.Println("following", path)
+	start := time.Now()
+
+	opts, closeBadLines, err := processOptions(flags)
+	if err != nil {
+		return err
+	}
+	defer closeBadLines()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening file for reading failed: %w", err)
+	}
+	defer file.Close()
+	if !isRegular(file) {
+		return errors.New("-follow only applies to regular files")
+	}
+	magic := make([]byte, len(zstdMagic))
+	n, _ := file.ReadAt(magic, 0)
+	if flags.Compression != "none" && detectCompression(file.Name(), magic[:n]) != "none" {
+		return errors.New("-follow can't read compressed files")
+	}
+
+	// the lines are counted so the line number of a malformed line is that within the file
+	opts.Progress = &brc.Progress{}
+	var results brc.Results
+	var offset, lines int64
+	changed := false
+	snapshots := time.NewTicker(flags.FollowPeriod)
+	defer snapshots.Stop()
+	poll := time.NewTicker(followPollInterval)
+	defer poll.Stop()
+	for {
+		end, err := lastLineEnd(file, offset)
+		if err != nil {
+			return fmt.Errorf("reading appended lines failed: %w", err)
+		}
+		if end < offset {
+			log.Println(path, "was truncated, starting over")
+			results, offset, lines, changed = brc.Results{}, 0, 0, true
+			continue
+		}
+
+		if end > offset {
+			opts.Offset, opts.Length = offset, end-offset
+			rows := opts.Progress.Rows()
+			part, err := brc.ProcessInputsContext(ctx, []io.Reader{file}, opts)
+			if err != nil && ctx.Err() == nil {
+				return offsetLineError(err, lines)
+			}
+			results.Merge(part)
+			offset, lines, changed = end, lines+opts.Progress.Rows()-rows, true
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("stopped following", path+", writing the final results")
+			if opts.MapStats != nil {
+				reportMapStats(opts.MapStats)
+			}
+			if flags.Checksum {
+				err = logChecksum(results, flags.ValueAsInt)
+				if err != nil {
+					return err
+				}
+			}
+			return writeSnapshot(results, flags, start)
+		case <-snapshots.C:
+			if changed {
+				err = writeSnapshot(results, flags, start)
+				if err != nil {
+					return err
+				}
+				changed = false
+			}
+		case <-poll.C:
+		}
+	}
+}
+
+// lastLineEnd returns the offset right after the last newline of file, or offset when there is no newline after it.
+// It returns the size of the file when the file was truncated below offset.
+func lastLineEnd(file *os.File, offset int64) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if size < offset {
+		return size, nil
+	}
+
+	// search backwards from the end, the newline is usually in the last block
+	buf := make([]byte, 64*1024)
+	for end := size; end > offset; {
+		start := max(end-int64(len(buf)), offset)
+		n, err := file.ReadAt(buf[:end-start], start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return offset, nil
+}
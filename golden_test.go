@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the outputs of the golden files in testdata instead of comparing them")
+
+// TestGolden processes every testdata/name.txt with the flags in name.flags in every golden variant and compares the
+// output with name.out, like validate -golden testdata
+func TestGolden(t *testing.T) {
+	cases, err := goldenCases("testdata", *update)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, c := range cases {
+		t.Run(filepath.Base(c.name)+" "+strings.Join(c.args, " "), func(t *testing.T) {
+			output, expected, err := c.run(*update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(output, expected) {
+				t.Errorf("expected %q\ngot      %q", expected, output)
+			}
+		})
+	}
+}
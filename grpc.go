@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"beruzebabu/go_1brc/brc"
+	"beruzebabu/go_1brc/brcpb"
+)
+
+type GRPCFlags struct {
+	Addr string
+}
+
+func parseGRPCFlags(args []string) (GRPCFlags, error) {
+	fs := flag.NewFlagSet("grpc", flag.ContinueOnError)
+	addr := fs.String("addr", ":50051", "address to serve the gRPC service on")
+	err := fs.Parse(args)
+	if err != nil {
+		return GRPCFlags{}, err
+	}
+
+	return GRPCFlags{*addr}, nil
+}
+
+// runGRPC serves the Aggregator gRPC service of brcpb until SIGINT or SIGTERM, other programs push readings with
+// Ingest and pull the statistics per station with GetResults
+func runGRPC(args []string) error {
+	flags, err := parseGRPCFlags(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", flags.Addr)
+	if err != nil {
+		return fmt.Errorf("starting server failed: %w", err)
+	}
+	log.Println("serving the aggregator service on", listener.Addr())
+
+	server := grpc.NewServer()
+	brcpb.RegisterAggregatorServer(server, &aggregatorServer{})
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	err = server.Serve(listener)
+	if err != nil {
+		return fmt.Errorf("serving the aggregator service failed: %w", err)
+	}
+	return nil
+}
+
+// aggregatorServer aggregates every Ingest stream separately, merging it into the results once the stream is done
+type aggregatorServer struct {
+	brcpb.UnimplementedAggregatorServer
+
+	mu      sync.Mutex
+	results brc.Results
+}
+
+func (s *aggregatorServer) Ingest(stream brcpb.Aggregator_IngestServer) error {
+	aggregation := brc.NewAggregation(brc.Options{})
+	var readings int64
+	for {
+		reading, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if reading.GetStation() == "" {
+			return status.Errorf(codes.InvalidArgument, "reading %d has no station", readings+1)
+		}
+
+		aggregation.Add([]byte(reading.GetStation()), reading.GetTemperature())
+		readings++
+	}
+
+	s.mu.Lock()
+	s.results.Merge(aggregation.Results())
+	s.mu.Unlock()
+	return stream.SendAndClose(&brcpb.IngestSummary{Readings: readings})
+}
+
+func (s *aggregatorServer) GetResults(_ context.Context, filter *brcpb.ResultsFilter) (*brcpb.StationResults, error) {
+	s.mu.Lock()
+	results := s.results.Rounded()
+	s.mu.Unlock()
+	results.Sort()
+
+	stations := make([]*brcpb.StationResult, 0, len(results.Stations))
+	for _, r := range results.Stations {
+		if len(filter.GetStations()) > 0 && !slices.Contains(filter.GetStations(), r.Station) {
+			continue
+		}
+		stations = append(stations, &brcpb.StationResult{
+			Station: r.Station,
+			Min:     r.Min,
+			Mean:    r.Mean,
+			Max:     r.Max,
+			Count:   int64(r.Readings),
+			Sum:     r.Sum,
+		})
+	}
+	return &brcpb.StationResults{Stations: stations}, nil
+}
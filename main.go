@@ -2,239 +2,1290 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"cmp"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
 	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/transform"
+
+	"beruzebabu/go_1brc/brc"
 )
 
 type CliFlags struct {
-	File string
+	Files         []string
+	Order         string
+	Sort          string // statistic the stations are sorted by with the sorted order
+	Desc          bool
+	Collation     *collate.Collator
+	NumberLocale  *message.Printer // formats the numbers of the csv and tsv output for a language, nil formats them for parsing
+	Top           int              // only write the first stations, 0 writes all of them
+	Stations      []string
+	StationRegex  *regexp.Regexp
+	AutoSize      bool
+	NumStations   int // expected number of distinct stations, 0 leaves the station tables to grow
+	StationList   *brc.StationSet
+	Range         *brc.ReadingRange // readings outside of it are excluded, nil aggregates all of them
+	ValueAsInt    bool
+	Parser        string
+	VerifyParse   bool
+	SelfTest      bool
+	Expected      string // file with the expected output, like the output of the Java baseline
+	ConcatStdin   bool
+	SummaryOnly   bool
+	Rewrite       *brc.Rewrite
+	Normalize     brc.Normalization
+	SortedInput   bool
+	Columns       []string // names of the value columns, empty when there is a single value column
+	Separator     byte     // separates the station from the reading in the input
+	DecimalComma  bool
+	Quoted        bool
+	IO            string
+	Workers       int
+	IOConcurrency int
+	MergeStrategy brc.MergeStrategy
+	Compression   string
+	Retries       int               // how often reading a remote input is retried after consecutive failures
+	Encoding      encoding.Encoding // encoding of the input, nil when it is UTF-8
+	Progress      bool
+	ProgressJSON  string // file or named pipe the progress records are written to as json lines, - for stderr
+	TimingsOutput string // file the -timings json summary is written to, empty writes it to stderr
+	TimingsJSON   bool
+	MapStats      bool
+	Checksum      bool
+	CPUProfile    string
+	MemProfile    string
+	PprofAddr     string
+	MetricsAddr   string
+	Partial       bool
+	Follow        bool
+	Watch         string // directory whose new files are processed as they appear
+	FollowPeriod  time.Duration
+	Checkpoint    string // file the state of the run is periodically written to
+	CheckpointDur time.Duration
+	Resume        bool
+	SpillStations int
+	SpillDir      string
+	MaxMemory     int64         // bytes processing is fitted in, 0 is no limit
+	SnapshotEvery time.Duration // how often the results so far are written while processing, 0 only writes the final results
+	Offset        int64
+	Length        int64
+	Limit         int64   // only the first lines of the input are processed, 0 processes all of them
+	Sample        float64 // fraction of the lines aggregated, 0 aggregates all of them
+	OnError       string
+	BadLines      string   // file the malformed lines are written to with -on-error collect
+	ErrorSample   int      // distinct malformed lines logged with -on-error skip or collect
+	Aggregations  []string // statistics to compute and write, nil for the default of the format
+	OutputFlags
 }
 
-type StationResult struct {
-	Station  string
-	Min      float64
-	Max      float64
-	Mean     float64
-	Readings int
+// OutputFlags are the flags shared by the subcommands that write results
+type OutputFlags struct {
+	Format    string
+	Delimiter rune // field delimiter of the csv and tsv formats
+	Output    string
+	InputUnit brc.Unit
+	Unit      brc.Unit // unit the results are converted to from InputUnit when they are written
+	Pretty    bool     // indent the json output
 }
 
-func parseFlags() (CliFlags, error) {
-	file := flag.String("file", "", "specify the file to process")
-	flag.Parse()
+// registerOutputFlags registers the output flags on fs, the returned function validates and returns them once fs is parsed
+func registerOutputFlags(fs *flag.FlagSet) func() (OutputFlags, error) {
+	format := fs.String("format", "brc", "output format: brc ({Abha=-23.0/18.0/59.2, ...}), json, csv, tsv, parquet, sqlite (a station_stats table in the -output database) or arrow (an Arrow IPC stream)")
+	csvDelimiter := fs.String("csv-delimiter", "", "field delimiter of the csv and tsv formats, defaults to a comma for csv and a tab for tsv")
+	output := fs.String("output", "", "write the results to this file instead of stdout, the file is only replaced once all results are written")
+	inputUnit := fs.String("input-unit", "c", "temperature unit of the readings: c (Celsius), f (Fahrenheit) or k (Kelvin)")
+	unit := fs.String("unit", "c", "temperature unit the results are written in, converted from -input-unit: c (Celsius), f (Fahrenheit) or k (Kelvin). Histograms stay in -input-unit")
+	pretty := fs.Bool("json-pretty", false, "indent the json output for reading it, it is compact by default")
 
-	if *file == "" {
-		return CliFlags{}, errors.New("no file specified")
-	}
+	return func() (OutputFlags, error) {
+		if !slices.Contains([]string{"brc", "json", "csv", "tsv", "parquet", "sqlite", "arrow"}, *format) {
+			return OutputFlags{}, fmt.Errorf("unknown format %q", *format)
+		}
+		if *format == "sqlite" && *output == "" {
+			return OutputFlags{}, errors.New("the sqlite format needs an -output database")
+		}
+		if *pretty && *format != "json" {
+			return OutputFlags{}, errors.New("-json-pretty only applies to the json format")
+		}
 
-	return CliFlags{*file}, nil
-}
+		delimiter := ','
+		if *format == "tsv" {
+			delimiter = '\t'
+		}
+		if *csvDelimiter != "" {
+			runes := []rune(*csvDelimiter)
+			if len(runes) != 1 {
+				return OutputFlags{}, fmt.Errorf("-csv-delimiter must be a single character, got %q", *csvDelimiter)
+			}
+			delimiter = runes[0]
+		}
 
-func processFile(filepath string) error {
-	log.Println("starting to process", filepath)
-	start := time.Now()
+		from, err := parseUnit(*inputUnit)
+		if err != nil {
+			return OutputFlags{}, fmt.Errorf("invalid -input-unit: %w", err)
+		}
+		to, err := parseUnit(*unit)
+		if err != nil {
+			return OutputFlags{}, fmt.Errorf("invalid -unit: %w", err)
+		}
 
-	file, err := os.Open(filepath)
+		return OutputFlags{*format, delimiter, *output, from, to, *pretty}, nil
+	}
+}
+
+func parseProcessFlags(args []string) (CliFlags, error) {
+	fs := flag.NewFlagSet("process", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go_1brc [process] -file measurements.txt [flags]")
+		fmt.Fprintln(fs.Output(), "       go_1brc generate|validate|bench|merge|serve|consume|grpc|diff [flags]")
+		fs.PrintDefaults()
+	}
+	var files fileList
+	fs.Var(&files, "file", "specify the file to process, - or no file reads the measurements from stdin. http(s):// and s3:// URLs are streamed. Can be repeated or a glob like 'measurements-*.txt', all files are aggregated together")
+	order := fs.String("order", "sorted", "output order of the stations: sorted or insertion (first seen in the file)")
+	sortKey := fs.String("sort", "name", "statistic the stations are sorted by: name, min, max, mean or count, ties are sorted by name")
+	desc := fs.Bool("desc", false, "sort the stations in descending order")
+	collation := fs.String("collation", "binary", "how station names are ordered: binary (byte by byte, like the Java baseline for most datasets), unicode (the Unicode collation algorithm) or locale=xx for the rules of a language like locale=de or locale=tr")
+	stations := fs.String("stations", "", "comma separated names of the only stations to aggregate, like Hamburg,Paris")
+	stationRegex := fs.String("station-regex", "", "only aggregate the stations matching this regexp, combined with -stations a station is kept when it matches either")
+	top := fs.Int("top", 0, "only write the first N stations in the output order, like the 20 hottest with -sort mean -desc")
+	stationList := fs.String("station-list", "", "file with the names of all stations in the input, one per line. Stations are then looked up with a perfect hash over them, other stations are malformed lines")
+	expectedStations := fs.Int("expected-stations", 0, "number of distinct stations expected, pre-sizes the station tables so they don't grow while reading. Takes precedence over the -autosize estimate")
+	autosize := fs.Bool("autosize", false, "sample the file first to pre-size the station map and read buffer")
+	minTemp := fs.String("min-temp", "", "exclude readings below this temperature from the aggregation, like corrupted sensor readings, and count them")
+	maxTemp := fs.String("max-temp", "", "exclude readings above this temperature from the aggregation, like corrupted sensor readings, and count them")
+	valueAsInt := fs.Bool("value-as-int", false, "parse the values as plain integers instead of decimals, skipping the float parser")
+	concatStdin := fs.Bool("concat-stdin", false, "also aggregate the measurements piped into stdin, as if they were appended to the file")
+	summaryOnly := fs.Bool("summary-only", false, "only write a summary of the whole file instead of the per station results, as lines in the brc format or in the json, csv or tsv format")
+	rewrite := fs.String("rewrite", "", "rewrite station names with a 'pattern=>replacement' regexp substitution, merging stations that end up with the same name")
+	normalize := fs.String("normalize", "", "comma separated normalizations of the station names, merging the stations which end up with the same name: trim (the surrounding whitespace), casefold (Paris and PARIS become paris) and nfc (Unicode normalization form C, composed and decomposed forms of a name become one). Applied before -rewrite")
+	sortedInput := fs.Bool("sorted-input", false, "the file is sorted by station name, aggregate it in a single pass without a map (errors if it isn't sorted)")
+	delimiter := fs.String("delimiter", ";", "separator between the station and the reading (and the value columns) in the input, a single character like , or | or tab")
+	quoted := fs.Bool("quoted", false, "station names may be enclosed in double quotes to contain the separator, like \"St. John;s\";12.3, with a quote within the name doubled")
+	decimalComma := fs.Bool("decimal-comma", false, "the readings have a decimal comma instead of a point, like 12,3")
+	columns := fs.String("columns", "name,temp", "comma separated names of the columns in the file, the first being the station name and the rest numeric values to aggregate")
+	ioMode := fs.String("io", "scanner", "how the file is read: scanner (buffered reads) or mmap (memory mapped, linux and macOS only)")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of chunks every file is split into and read in parallel")
+	mergeStrategy := fs.String("merge-strategy", "private", "how the stations of the workers are combined: private (a table per worker, merged at the end) or sharded (shared tables sharded by hash, each with its own lock)")
+	ioConcurrency := fs.Int("io-concurrency", 0, "maximum number of reads in flight at once, 1 keeps a spinning disk reading sequentially, 0 is no limit")
+	progress := fs.Bool("progress", false, "log the bytes and rows processed so far every second, with the percentage and ETA when the input size is known")
+	progressJSON := fs.String("progress-json", "", "write the progress every second as a line of json with bytesRead, totalBytes, percent, rows, rowsPerSec and etaSeconds to this file or named pipe, - for stderr")
+	timings := fs.String("timings", "", "write a summary of the time spent per phase with the rows and bytes read for benchmark automation, only json is supported")
+	timingsOutput := fs.String("timings-output", "", "write the -timings summary to this file instead of stderr")
+	numberLocale := fs.String("number-locale", "", "format the numbers of the csv and tsv output with the decimal and grouping separators of a language for reading, like de for 1.234,5. By default they are formatted for parsing like 1234.5")
+	checksum := fs.Bool("checksum", false, "log the SHA-256 of the results in the output format of the challenge sorted by name, whatever the output flags, to compare runs by a single line")
+	mapStats := fs.Bool("dump-map-stats", false, "log the load factor, resizes, longest probe sequence and collisions of the station tables after the run, to check the hash function and table sizing on an input")
+	cpuProfile := fs.String("cpuprofile", "", "write a cpu profile of the processing to this file")
+	memProfile := fs.String("memprofile", "", "write a memory profile to this file once processing is done")
+	offset := fs.Int64("offset", 0, "only process the lines starting at or after this byte offset, to shard a file over several processes and merge their -format json results later")
+	length := fs.Int64("length", 0, "only process the lines starting within this many bytes from -offset, 0 reads to the end of the file")
+	limit := fs.Int64("limit", 0, "only process the first N lines of the input, malformed ones included, and write the results of them. The lines are read in a single chunk")
+	sample := fs.Float64("sample", 0, "only aggregate about this fraction of the lines for a quick approximate run, like 0.01 for every hundredth line. The statistics and counts are those of the sample. Files are read in evenly spread blocks of lines, skipping the rest")
+	agg := fs.String("agg", "", "comma separated statistics to compute and write, in order: min, max, mean, count, sum, stddev, estimated percentiles like p50 or p99.9 and histogram (1 degree buckets, json format only). Defaults to min,mean,max, with count for csv and tsv and count and sum for json")
+	follow := fs.Bool("follow", false, "keep reading lines appended to the file like tail -f, writing a snapshot of the results every -follow-interval until SIGINT or SIGTERM")
+	followInterval := fs.Duration("follow-interval", 10*time.Second, "how often -follow writes a snapshot of the results, when they changed")
+	watch := fs.String("watch", "", "process every file created in this directory as it appears until SIGINT or SIGTERM, merging it into the cumulative results which are written after every file")
+	checkpoint := fs.String("checkpoint", "", "periodically write the results so far and the offset they reach to this file, so an interrupted run can continue with -resume")
+	checkpointInterval := fs.Duration("checkpoint-interval", 30*time.Second, "how often -checkpoint is written")
+	resume := fs.Bool("resume", false, "continue from the -checkpoint file instead of the start of the file")
+	spillStations := fs.Int("spill-stations", 0, "spill the stations of a chunk to temporary files once it holds this many, for more stations than fit in memory. The stations are then merged partition by partition and come out sorted by name")
+	spillDir := fs.String("spill-dir", "", "directory of the -spill-stations files, defaults to the temporary directory")
+	maxMemory := fs.String("max-memory", "", "fit processing in this much memory, like 2GB, by sizing the read buffers and the number of chunks and spilling stations to disk when there are too many. Also the soft memory limit of the garbage collector")
+	snapshotEvery := fs.Duration("snapshot-every", 0, "write the results aggregated so far every interval like 10s while processing continues, to -output or stdout like the final results")
+	partial := fs.Bool("partial", false, "when interrupted by SIGINT or SIGTERM, still write the results aggregated so far")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics of the bytes and rows read, malformed lines, stations and phase durations on this address at /metrics, like :9090")
+	pprofAddr := fs.String("pprof-addr", "", "serve net/http/pprof on this address, like :6060, while processing")
+	onError := fs.String("on-error", "fatal", "what happens to malformed lines: fatal (stop with the line number), skip (count and report them at the end) or collect (like skip, writing them to -bad-lines)")
+	badLines := fs.String("bad-lines", "bad-lines.txt", "file the malformed lines are written to with -on-error collect")
+	errorSample := fs.Int("error-sample", 10, "log the first N distinct malformed lines with -on-error skip or collect, still counting all of them. 0 logs none")
+	inputEncoding := fs.String("encoding", "utf-8", "character encoding of the input, transcoded to UTF-8 while reading: any WHATWG label like latin1, windows-1252, iso-8859-2, utf-16le, utf-16be or shift_jis. Input in another encoding than UTF-8 is read in a single chunk")
+	retry := fs.Int("retry", 5, "how often reading an http(s) or s3 input is retried from the byte it got to after consecutive failures, with a backoff doubling from 0.5s. The source has to support range requests and ETags. 0 fails right away")
+	compression := fs.String("compression", "auto", "compression of the files and of -concat-stdin: auto (by extension or magic bytes), none, gzip or zstd")
+	outputFlags := registerOutputFlags(fs)
+	parser := fs.String("parser", "fixed", "how readings are parsed: fixed (at most one decimal, exact and fastest) or float (any decimal)")
+	selfTest := fs.Bool("selftest", false, "process a small generated dataset in every mode and compare the output with the known one, to check a build before a long run. The other flags are ignored")
+	expected := fs.String("expected", "", "compare the results in the output format of the challenge, sorted by name, with the expected output in this file like the output of the Java baseline, failing with the stations that differ")
+	verifyParse := fs.Bool("verify-parse", false, "debug mode comparing the parser with strconv.ParseFloat on every reading, stopping at the first mismatch")
+	err := fs.Parse(args)
 	if err != nil {
-		return fmt.Errorf("opening file for reading failed: %w", err)
+		return CliFlags{}, err
+	}
+
+	if *selfTest {
+		return CliFlags{SelfTest: true}, nil
+	}
+
+	if *watch != "" && (len(files) > 0 || *concatStdin || *follow || *offset != 0 || *length != 0) {
+		return CliFlags{}, errors.New("-watch can't be combined with -file, -concat-stdin, -follow, -offset or -length")
+	}
+	if len(files) == 0 && *watch == "" {
+		piped, err := stdinPiped()
+		if err != nil {
+			return CliFlags{}, err
+		}
+		if !piped {
+			return CliFlags{}, errors.New("no file specified and nothing piped into stdin")
+		}
+		files = fileList{"-"}
 	}
-	defer file.Close()
 
-	stations := map[string]*StationResult{}
-	scanner := bufio.NewScanner(file)
-	buf := make([]byte, 4096*4096)
-	scanner.Buffer(buf, 4096*32768)
-	for scanner.Scan() {
-		token := scanner.Bytes()
-		i := slices.Index(token, 0x3B)
+	if stdinFiles := slices.Index(files, "-"); stdinFiles >= 0 && *concatStdin {
+		return CliFlags{}, errors.New("-concat-stdin can't be used when reading a file from stdin")
+	} else if stdinFiles >= 0 && slices.Index(files[stdinFiles+1:], "-") >= 0 {
+		return CliFlags{}, errors.New("stdin can only be read once")
+	}
+
+	if *ioMode != "scanner" && *ioMode != "mmap" {
+		return CliFlags{}, fmt.Errorf("unknown io %q", *ioMode)
+	}
 
-		if i < 0 {
+	if (*offset != 0 || *length != 0) && (len(files) > 1 || *concatStdin) {
+		return CliFlags{}, errors.New("-offset and -length only apply to a single file")
+	}
+
+	var aggregations []string
+	if *agg != "" {
+		aggregations = strings.Split(*agg, ",")
+	}
+	for _, a := range aggregations {
+		if slices.Contains([]string{"min", "max", "mean", "count", "sum", "stddev", "histogram"}, a) {
 			continue
 		}
+		if _, err := parsePercentile(a); err != nil {
+			return CliFlags{}, fmt.Errorf("unknown aggregation %q", a)
+		}
+	}
 
-		station := string(token[:i])
-		mant, exp, neg, _, _, _, ok := readFloat(string(token[i+1:]))
-		reading, ok := atof64exact(mant, exp, neg) // this could be faster, but would require a different implementation which takes more shortcuts
-		if !ok {
-			log.Fatalln("Failed to parse to float", string(token[i+1:]))
+	if *follow && (len(files) != 1 || files[0] == "-" || *concatStdin) {
+		return CliFlags{}, errors.New("-follow only applies to a single file")
+	}
+	if *follow && (*offset != 0 || *length != 0) {
+		return CliFlags{}, errors.New("-follow can't be combined with -offset and -length")
+	}
+	if *followInterval <= 0 {
+		return CliFlags{}, errors.New("-follow-interval must be positive")
+	}
+
+	if *checkpoint != "" && (len(files) != 1 || files[0] == "-" || isRemote(files[0]) || *concatStdin || *follow || *watch != "") {
+		return CliFlags{}, errors.New("-checkpoint only applies to a single local file, without -follow or -watch")
+	}
+	if *limit < 0 {
+		return CliFlags{}, errors.New("-limit can't be negative")
+	}
+	if *limit > 0 && (*follow || *watch != "" || *checkpoint != "" || *snapshotEvery != 0) {
+		return CliFlags{}, errors.New("-limit can't be combined with -follow, -watch, -checkpoint or -snapshot-every")
+	}
+	if !(*sample >= 0 && *sample <= 1) {
+		return CliFlags{}, errors.New("-sample must be between 0 and 1")
+	}
+	if *sample > 0 && (*follow || *watch != "" || *checkpoint != "" || *snapshotEvery != 0) {
+		return CliFlags{}, errors.New("-sample can't be combined with -follow, -watch, -checkpoint or -snapshot-every")
+	}
+
+	if *checkpoint != "" && (*offset != 0 || *length != 0) {
+		return CliFlags{}, errors.New("-checkpoint can't be combined with -offset and -length")
+	}
+	if *snapshotEvery != 0 && (len(files) != 1 || files[0] == "-" || isRemote(files[0]) || *concatStdin || *follow || *watch != "" || *offset != 0 || *length != 0) {
+		return CliFlags{}, errors.New("-snapshot-every only applies to a single local file, without -follow, -watch, -offset or -length")
+	}
+	if *snapshotEvery < 0 {
+		return CliFlags{}, errors.New("-snapshot-every can't be negative")
+	}
+	if *resume && *checkpoint == "" {
+		return CliFlags{}, errors.New("-resume needs the -checkpoint to resume from")
+	}
+	if *checkpointInterval <= 0 {
+		return CliFlags{}, errors.New("-checkpoint-interval must be positive")
+	}
+
+	if *spillStations < 0 {
+		return CliFlags{}, errors.New("-spill-stations can't be negative")
+	}
+
+	var memoryBudget int64
+	if *maxMemory != "" {
+		memoryBudget, err = parseSize(*maxMemory)
+		if err != nil {
+			return CliFlags{}, fmt.Errorf("invalid -max-memory: %w", err)
 		}
-		v, ok := stations[station]
-		if !ok {
-			stations[station] = &StationResult{Station: station, Min: reading, Max: reading, Mean: reading, Readings: 1}
-			continue
+	}
+
+	if *expectedStations < 0 {
+		return CliFlags{}, errors.New("-expected-stations can't be negative")
+	}
+
+	if *workers < 1 {
+		return CliFlags{}, errors.New("-workers must be at least 1")
+	}
+	if *ioConcurrency < 0 {
+		return CliFlags{}, errors.New("-io-concurrency can't be negative")
+	}
+
+	strategy, err := parseMergeStrategy(*mergeStrategy)
+	if err != nil {
+		return CliFlags{}, err
+	}
+
+	if *timings != "" && *timings != "json" {
+		return CliFlags{}, fmt.Errorf("unknown -timings %q", *timings)
+	}
+
+	if !slices.Contains([]string{"fatal", "skip", "collect"}, *onError) {
+		return CliFlags{}, fmt.Errorf("unknown -on-error %q", *onError)
+	}
+	if *errorSample < 0 {
+		return CliFlags{}, errors.New("-error-sample can't be negative")
+	}
+
+	if *retry < 0 {
+		return CliFlags{}, errors.New("-retry can't be negative")
+	}
+	if !slices.Contains([]string{"auto", "none", "gzip", "zstd"}, *compression) {
+		return CliFlags{}, fmt.Errorf("unknown compression %q", *compression)
+	}
+	enc, err := parseEncoding(*inputEncoding)
+	if err != nil {
+		return CliFlags{}, err
+	}
+	if enc != nil && (*offset != 0 || *length != 0 || *follow || *watch != "" || *checkpoint != "" || *snapshotEvery != 0) {
+		return CliFlags{}, errors.New("-encoding can't be combined with -offset, -length, -follow, -watch, -checkpoint or -snapshot-every")
+	}
+
+	output, err := outputFlags()
+	if err != nil {
+		return CliFlags{}, err
+	}
+	locale, err := parseNumberLocale(*numberLocale)
+	if err != nil {
+		return CliFlags{}, err
+	}
+	if locale != nil && output.Format != "csv" && output.Format != "tsv" {
+		return CliFlags{}, errors.New("-number-locale only applies to the csv and tsv formats")
+	}
+	if slices.Contains(aggregations, "histogram") && output.Format != "json" && output.Format != "parquet" {
+		return CliFlags{}, errors.New("histograms are only written in the json and parquet formats")
+	}
+	if slices.Contains(aggregations, "histogram") && output.Unit != output.InputUnit {
+		return CliFlags{}, errors.New("histograms can't be converted to another -unit")
+	}
+
+	if *parser != "fixed" && *parser != "float" {
+		return CliFlags{}, fmt.Errorf("unknown parser %q", *parser)
+	}
+	if *valueAsInt && *parser == "float" {
+		return CliFlags{}, errors.New("-value-as-int can't be combined with -parser float")
+	}
+
+	if *order != "sorted" && *order != "insertion" {
+		return CliFlags{}, fmt.Errorf("unknown order %q", *order)
+	}
+	if !slices.Contains([]string{"name", "min", "max", "mean", "count"}, *sortKey) {
+		return CliFlags{}, fmt.Errorf("unknown sort %q", *sortKey)
+	}
+	if *top < 0 {
+		return CliFlags{}, errors.New("-top can't be negative")
+	}
+	collator, err := parseCollation(*collation)
+	if err != nil {
+		return CliFlags{}, err
+	}
+	if *order == "insertion" && strategy == brc.MergeSharded {
+		return CliFlags{}, errors.New("-order insertion can't be combined with -merge-strategy sharded")
+	}
+	if *order == "insertion" && (*spillStations > 0 || memoryBudget > 0) {
+		// spilled stations are merged partition by partition and come out sorted by name
+		return CliFlags{}, errors.New("-order insertion can't be combined with -spill-stations or -max-memory")
+	}
+
+	var stationNames []string
+	if *stations != "" {
+		stationNames = strings.Split(*stations, ",")
+	}
+	var stationPattern *regexp.Regexp
+	if *stationRegex != "" {
+		stationPattern, err = regexp.Compile(*stationRegex)
+		if err != nil {
+			return CliFlags{}, fmt.Errorf("invalid -station-regex: %w", err)
+		}
+	}
+
+	var stationSet *brc.StationSet
+	if *stationList != "" {
+		stationSet, err = readStationList(*stationList)
+		if err != nil {
+			return CliFlags{}, err
 		}
+	}
 
-		if v.Min > reading {
-			v.Min = reading
-		} else if v.Max < reading {
-			v.Max = reading
+	var readingRange *brc.ReadingRange
+	if *minTemp != "" || *maxTemp != "" {
+		readingRange, err = parseRange(*minTemp, *maxTemp)
+		if err != nil {
+			return CliFlags{}, err
 		}
-		v.Mean += reading
-		v.Readings += 1
 	}
 
-	log.Println("all readings read from file", time.Since(start))
+	var normalization brc.Normalization
+	if *normalize != "" {
+		normalization, err = brc.ParseNormalization(*normalize)
+		if err != nil {
+			return CliFlags{}, fmt.Errorf("invalid -normalize: %w", err)
+		}
+	}
 
-	stationsSlice := []*StationResult{}
-	for s, r := range stations {
-		min := r.Min
-		max := r.Max
-		mean := r.Mean / float64(r.Readings)
+	var r *brc.Rewrite
+	if *rewrite != "" {
+		r, err = brc.ParseRewrite(*rewrite)
+		if err != nil {
+			return CliFlags{}, err
+		}
+	}
 
-		result := &StationResult{s, min, max, mean, 0}
-		stationsSlice = append(stationsSlice, result)
+	separator, err := parseSeparator(*delimiter)
+	if err != nil {
+		return CliFlags{}, err
 	}
 
-	log.Println("calculated min/max/mean", time.Since(start))
+	valueColumns := strings.Split(*columns, ",")[1:]
+	if len(valueColumns) == 0 {
+		return CliFlags{}, errors.New("-columns needs at least a name and a value column")
+	}
+	if len(valueColumns) == 1 {
+		valueColumns = nil // a single value column takes the regular path
+	}
+	if aggregations != nil && valueColumns != nil {
+		return CliFlags{}, errors.New("-agg can't be combined with multiple value columns")
+	}
+	if *summaryOnly && (output.Format == "parquet" || output.Format == "arrow") {
+		return CliFlags{}, errors.New("-summary-only is only written in the brc, json, csv and tsv formats")
+	}
+	if *summaryOnly && output.Format == "sqlite" {
+		// the summary would replace the database
+		return CliFlags{}, errors.New("-summary-only can't be combined with -format sqlite")
+	}
+	if *expected != "" && (valueColumns != nil || *summaryOnly || *top > 0) {
+		return CliFlags{}, errors.New("-expected can't be combined with multiple value columns, -summary-only or -top")
+	}
+	if *expected != "" && (*follow || *watch != "" || *checkpoint != "" || *snapshotEvery != 0) {
+		return CliFlags{}, errors.New("-expected can't be combined with -follow, -watch, -checkpoint or -snapshot-every")
+	}
+
+	return CliFlags{
+		Files:         files,
+		Order:         *order,
+		Sort:          *sortKey,
+		Desc:          *desc,
+		Collation:     collator,
+		NumberLocale:  locale,
+		Top:           *top,
+		Stations:      stationNames,
+		StationRegex:  stationPattern,
+		AutoSize:      *autosize,
+		NumStations:   *expectedStations,
+		StationList:   stationSet,
+		Range:         readingRange,
+		ValueAsInt:    *valueAsInt,
+		Parser:        *parser,
+		VerifyParse:   *verifyParse,
+		Expected:      *expected,
+		ConcatStdin:   *concatStdin,
+		SummaryOnly:   *summaryOnly,
+		Rewrite:       r,
+		Normalize:     normalization,
+		SortedInput:   *sortedInput,
+		Columns:       valueColumns,
+		Separator:     separator,
+		DecimalComma:  *decimalComma,
+		Quoted:        *quoted,
+		IO:            *ioMode,
+		Workers:       *workers,
+		IOConcurrency: *ioConcurrency,
+		MergeStrategy: strategy,
+		Compression:   *compression,
+		Retries:       *retry,
+		Encoding:      enc,
+		Progress:      *progress,
+		ProgressJSON:  *progressJSON,
+		TimingsOutput: *timingsOutput,
+		TimingsJSON:   *timings == "json",
+		MapStats:      *mapStats,
+		Checksum:      *checksum,
+		CPUProfile:    *cpuProfile,
+		MemProfile:    *memProfile,
+		PprofAddr:     *pprofAddr,
+		MetricsAddr:   *metricsAddr,
+		Partial:       *partial,
+		Follow:        *follow,
+		Watch:         *watch,
+		FollowPeriod:  *followInterval,
+		Checkpoint:    *checkpoint,
+		CheckpointDur: *checkpointInterval,
+		Resume:        *resume,
+		SpillStations: *spillStations,
+		SpillDir:      *spillDir,
+		MaxMemory:     memoryBudget,
+		SnapshotEvery: *snapshotEvery,
+		Offset:        *offset,
+		Length:        *length,
+		Limit:         *limit,
+		Sample:        *sample,
+		OnError:       *onError,
+		BadLines:      *badLines,
+		ErrorSample:   *errorSample,
+		Aggregations:  aggregations,
+		OutputFlags:   output,
+	}, nil
+}
+
+// parseSeparator parses the -delimiter of the input, tab standing for a tab character which is awkward to pass in a shell
+func parseSeparator(delimiter string) (byte, error) {
+	if delimiter == "tab" || delimiter == `\t` {
+		return '\t', nil
+	}
+	if len(delimiter) != 1 {
+		return 0, fmt.Errorf("-delimiter must be a single ASCII character, got %q", delimiter)
+	}
+	return delimiter[0], nil
+}
+
+// parseCollation parses the -collation of the station names, binary returning nil
+func parseCollation(collation string) (*collate.Collator, error) {
+	switch collation {
+	case "binary":
+		return nil, nil
+	case "unicode":
+		return collate.New(language.Und), nil
+	}
+	locale, ok := strings.CutPrefix(collation, "locale=")
+	if !ok {
+		return nil, fmt.Errorf("unknown -collation %q", collation)
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -collation locale: %w", err)
+	}
+	return collate.New(tag), nil
+}
+
+// parseNumberLocale parses the language tag of -number-locale, empty returning nil
+func parseNumberLocale(locale string) (*message.Printer, error) {
+	if locale == "" {
+		return nil, nil
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -number-locale: %w", err)
+	}
+	return message.NewPrinter(tag), nil
+}
+
+// parseEncoding looks up the character encoding of the input by its WHATWG label, UTF-8 returning nil
+func parseEncoding(label string) (encoding.Encoding, error) {
+	// the labels without a hyphen people tend to write
+	switch label {
+	case "utf16le":
+		label = "utf-16le"
+	case "utf16be":
+		label = "utf-16be"
+	}
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("unknown -encoding %q", label)
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// decodeInput transcodes the input from the encoding to UTF-8 while it is read, or returns it as is for a nil encoding
+func decodeInput(input io.Reader, enc encoding.Encoding) io.Reader {
+	if enc == nil {
+		return input
+	}
+	return transform.NewReader(input, enc.NewDecoder())
+}
+
+// parseUnit parses a temperature unit by its letter
+func parseUnit(unit string) (brc.Unit, error) {
+	switch unit {
+	case "c", "C":
+		return brc.Celsius, nil
+	case "f", "F":
+		return brc.Fahrenheit, nil
+	case "k", "K":
+		return brc.Kelvin, nil
+	}
+	return 0, fmt.Errorf("unknown unit %q", unit)
+}
 
-	slices.SortFunc(stationsSlice, func(a *StationResult, b *StationResult) int {
-		return strings.Compare(a.Station, b.Station)
-	})
+// parseRange parses the -min-temp and -max-temp flags into the range of readings, a bound which isn't set is unbounded
+func parseRange(minTemp, maxTemp string) (*brc.ReadingRange, error) {
+	r := brc.AllReadings
+	var err error
+	if minTemp != "" {
+		r.Min, err = strconv.ParseFloat(minTemp, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -min-temp: %w", err)
+		}
+	}
+	if maxTemp != "" {
+		r.Max, err = strconv.ParseFloat(maxTemp, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -max-temp: %w", err)
+		}
+	}
+	if !(r.Min <= r.Max) {
+		return nil, errors.New("-min-temp can't be above -max-temp")
+	}
+	return &r, nil
+}
 
-	log.Println("sorted", time.Since(start))
+// parseMergeStrategy parses the -merge-strategy of the workers
+func parseMergeStrategy(strategy string) (brc.MergeStrategy, error) {
+	switch strategy {
+	case "private":
+		return brc.MergePrivate, nil
+	case "sharded":
+		return brc.MergeSharded, nil
+	}
+	return 0, fmt.Errorf("unknown -merge-strategy %q", strategy)
+}
+
+// readStationList builds the perfect hash over the station names in the file at path, one per line, skipping blank lines
+func readStationList(path string) (*brc.StationSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading -station-list failed: %w", err)
+	}
 
+	var names []string
+	for line := range strings.Lines(string(data)) {
+		name := strings.TrimRight(line, "\r\n")
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	set, err := brc.NewStationSet(names)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -station-list: %w", err)
+	}
+	return set, nil
+}
+
+// parsePercentile parses a percentile aggregation like p99 into its quantile, 0.99
+func parsePercentile(agg string) (float64, error) {
+	p, ok := strings.CutPrefix(agg, "p")
+	if !ok {
+		return 0, fmt.Errorf("%q is not a percentile", agg)
+	}
+	v, err := strconv.ParseFloat(p, 64)
+	if err != nil || !(v >= 0 && v <= 100) {
+		return 0, fmt.Errorf("%q is not a percentile", agg)
+	}
+	return v / 100, nil
+}
+
+// percentiles returns the quantiles of the percentile aggregations, in order
+func percentiles(aggregations []string) []float64 {
+	var quantiles []float64
+	for _, a := range aggregations {
+		if q, err := parsePercentile(a); err == nil {
+			quantiles = append(quantiles, q)
+		}
+	}
+	return quantiles
+}
+
+// fileList is a flag that can be repeated, globs are expanded into the files they match
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	if value == "-" || isRemote(value) || !strings.ContainsAny(value, "*?[") {
+		*f = append(*f, value)
+		return nil
+	}
+
+	matches, err := filepath.Glob(value)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no files match %q", value)
+	}
+	*f = append(*f, matches...)
 	return nil
 }
 
-func sum[T cmp.Ordered](slice []T) T {
-	var sum T
-	for _, v := range slice {
-		sum += v
+// stdinPiped reports whether stdin is a pipe or file rather than a terminal
+func stdinPiped() (bool, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false, fmt.Errorf("checking stdin failed: %w", err)
 	}
-	return sum
+	return info.Mode()&os.ModeCharDevice == 0, nil
 }
 
-// FROM STDLIB BUT UNNECESSARY PARTS REMOVED
-func readFloat(s string) (mantissa uint64, exp int, neg, trunc, hex bool, i int, ok bool) {
-	// optional sign
-	if i >= len(s) {
-		return
+func isRegular(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
+
+// isParquet reports whether file is a parquet file, by its extension or its magic bytes. Parquet files have to be
+// regular files, their metadata is at the end.
+func isParquet(file *os.File) bool {
+	if !isRegular(file) {
+		return false
+	}
+	if filepath.Ext(file.Name()) == ".parquet" {
+		return true
+	}
+	magic := make([]byte, len(parquetMagic))
+	n, _ := file.ReadAt(magic, 0)
+	return bytes.Equal(magic[:n], parquetMagic)
+}
+
+// inputSize returns the total size of the inputs, or 0 when it isn't known because not all of them are uncompressed regular files
+func inputSize(inputs []io.Reader) int64 {
+	var total int64
+	for _, input := range inputs {
+		file, ok := input.(*os.File)
+		if !ok {
+			return 0
+		}
+		info, err := file.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+// openInput opens the file to process, - being stdin
+func openInput(filepath string) (*os.File, error) {
+	if filepath == "-" {
+		return os.Stdin, nil
+	}
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("opening file for reading failed: %w", err)
+	}
+	return file, nil
+}
+
+// processOptions returns the options of processing selected by the flags, the returned function closes the file the
+// malformed lines are collected in
+func processOptions(flags CliFlags) (opts brc.Options, closeBadLines func(), err error) {
+	opts = brc.Options{
+		Workers:          flags.Workers,
+		IOConcurrency:    flags.IOConcurrency,
+		MergeStrategy:    flags.MergeStrategy,
+		ExpectedStations: flags.NumStations,
+		StationSet:       flags.StationList,
+		Range:            flags.Range,
+		VerifyParse:      flags.VerifyParse,
+		Mmap:             flags.IO == "mmap",
+		SortedInput:      flags.SortedInput,
+		Columns:          flags.Columns,
+		Separator:        flags.Separator,
+		DecimalComma:     flags.DecimalComma,
+		Quoted:           flags.Quoted,
+		Rewrite:          flags.Rewrite,
+		Normalize:        flags.Normalize,
+		Offset:           flags.Offset,
+		Length:           flags.Length,
+		Limit:            flags.Limit,
+		Sample:           flags.Sample,
+		SpillStations:    flags.SpillStations,
+		SpillDir:         flags.SpillDir,
+		StdDev:           slices.Contains(flags.Aggregations, "stddev"),
+		Percentiles:      percentiles(flags.Aggregations),
+		Histogram:        slices.Contains(flags.Aggregations, "histogram"),
+		// without any statistic of the values only the lines have to be counted
+		SkipValues: flags.Aggregations != nil && !slices.ContainsFunc(flags.Aggregations, func(a string) bool { return a != "count" }),
+	}
+	if flags.MapStats {
+		opts.MapStats = &brc.MapStats{}
+	}
+	if flags.Stations != nil || flags.StationRegex != nil {
+		opts.Stations = func(station string) bool {
+			return slices.Contains(flags.Stations, station) || flags.StationRegex != nil && flags.StationRegex.MatchString(station)
+		}
+	}
+	if flags.MaxMemory > 0 {
+		err = fitMemory(&opts, flags.MaxMemory)
+		if err != nil {
+			return brc.Options{}, nil, err
+		}
+	}
+	closeBadLines = func() {}
+	switch flags.OnError {
+	case "skip":
+		opts.OnError = brc.ErrorsSkip
+	case "collect":
+		opts.OnError = brc.ErrorsCollect
+		badLines, err := os.Create(flags.BadLines)
+		if err != nil {
+			return brc.Options{}, nil, fmt.Errorf("creating bad lines file failed: %w", err)
+		}
+		w := bufio.NewWriter(badLines)
+		opts.BadLine = func(line []byte) {
+			w.Write(line)
+			w.WriteByte('\n')
+		}
+		closeBadLines = func() {
+			w.Flush()
+			badLines.Close()
+		}
+	}
+	if opts.OnError != brc.ErrorsFatal && flags.ErrorSample > 0 {
+		// skipping the lines while passing them on is collecting them
+		opts.OnError = brc.ErrorsCollect
+		sample := &errorSample{max: flags.ErrorSample, logged: map[string]bool{}}
+		collect, closeCollected := opts.BadLine, closeBadLines
+		opts.BadLine = func(line []byte) {
+			sample.add(line)
+			if collect != nil {
+				collect(line)
+			}
+		}
+		closeBadLines = func() {
+			closeCollected()
+			sample.report()
+		}
 	}
 	switch {
-	case s[i] == '+':
-		i++
-	case s[i] == '-':
-		neg = true
-		i++
-	}
-
-	// digits
-	base := uint64(10)
-	maxMantDigits := 19 // 10^19 fits in uint64
-	sawdot := false
-	sawdigits := false
-	nd := 0
-	ndMant := 0
-	dp := 0
-loop:
-	for ; i < len(s); i++ {
-		switch c := s[i]; true {
-		case c == '.':
-			if sawdot {
-				break loop
+	case flags.ValueAsInt:
+		opts.Parser = brc.ParseInt
+	case flags.Parser == "float":
+		opts.Parser = brc.ParseFloat
+	}
+
+	return opts, closeBadLines, nil
+}
+
+// errorSample logs the first distinct malformed lines up to max, so a very dirty file doesn't flood the log, and
+// counts the rest
+type errorSample struct {
+	max    int
+	logged map[string]bool
+	more   int
+}
+
+func (s *errorSample) add(line []byte) {
+	if s.logged[string(line)] {
+		return
+	}
+	if len(s.logged) == s.max {
+		s.more++
+		return
+	}
+	s.logged[string(line)] = true
+	log.Printf("malformed line: %q", line)
+}
+
+// report logs the number of malformed lines which weren't logged, if any
+func (s *errorSample) report() {
+	if s.more > 0 {
+		log.Printf("...and %d more malformed lines", s.more)
+	}
+}
+
+func processFiles(ctx context.Context, paths []string, flags CliFlags) error {
+	log.Println("starting to process", strings.Join(paths, ", "))
+	start := time.Now()
+
+	opts, closeBadLines, err := processOptions(flags)
+	if err != nil {
+		return err
+	}
+	defer closeBadLines()
+
+	inputs := make([]io.Reader, 0, len(paths)+1)
+	var parquetFile *os.File
+	for _, path := range paths {
+		if isRemote(path) {
+			body, name, err := openRemote(ctx, path, flags.Retries)
+			if err != nil {
+				return err
 			}
-			sawdot = true
-			dp = nd
-			continue
+			defer body.Close()
 
-		case '0' <= c && c <= '9':
-			sawdigits = true
-			if c == '0' && nd == 0 { // ignore leading zeros
-				dp--
-				continue
+			input, err := decompressStream(body, name, flags.Compression)
+			if err != nil {
+				return err
 			}
-			nd++
-			if ndMant < maxMantDigits {
-				mantissa *= base
-				mantissa += uint64(c - '0')
-				ndMant++
-			} else if c != '0' {
-				trunc = true
+			if c, ok := input.(io.Closer); ok {
+				defer c.Close()
 			}
+			inputs = append(inputs, decodeInput(input, flags.Encoding))
 			continue
 		}
-		break
+
+		file, err := openInput(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if isParquet(file) {
+			if len(paths) > 1 || flags.ConcatStdin {
+				return errors.New("parquet files can only be processed on their own")
+			}
+			parquetFile = file
+			inputs = append(inputs, file)
+			continue
+		}
+		input, err := decompress(file, flags.Compression)
+		if err != nil {
+			return err
+		}
+		if c, ok := input.(io.Closer); ok && input != io.Reader(file) {
+			defer c.Close()
+		}
+		inputs = append(inputs, decodeInput(input, flags.Encoding))
 	}
-	if !sawdigits {
-		return
+
+	// the first file is taken as representative for all of them
+	first, ok := inputs[0].(*os.File)
+	if flags.AutoSize && parquetFile != nil {
+		log.Println("skipping -autosize, parquet files aren't sampled")
+	} else if flags.AutoSize && (!ok || !isRegular(first)) {
+		log.Println("skipping -autosize, only uncompressed regular files can be sampled up front")
+	} else if flags.AutoSize {
+		err = autoSize(&opts, first, flags, start)
+		if err != nil {
+			return err
+		}
 	}
-	if !sawdot {
-		dp = nd
+
+	if flags.ConcatStdin {
+		piped, err := stdinPiped()
+		if err != nil {
+			return err
+		}
+		if !piped {
+			return errors.New("-concat-stdin requires measurements to be piped into stdin")
+		}
+
+		stdin, err := decompress(os.Stdin, flags.Compression)
+		if err != nil {
+			return err
+		}
+		if c, ok := stdin.(io.Closer); ok && stdin != io.Reader(os.Stdin) {
+			defer c.Close()
+		}
+		inputs = append(inputs, decodeInput(stdin, flags.Encoding))
 	}
 
-	if mantissa != 0 {
-		exp = dp - ndMant
+	if flags.Progress || flags.ProgressJSON != "" || flags.TimingsJSON || flags.MetricsAddr != "" {
+		opts.Progress = &brc.Progress{}
+	}
+	if flags.Progress || flags.ProgressJSON != "" {
+		stop, err := startProgress(opts.Progress, inputSize(inputs), flags)
+		if err != nil {
+			return err
+		}
+		defer stop()
 	}
+	opts.Timings = &brc.Timings{}
 
-	ok = true
-	return
-}
+	var m *metrics
+	if flags.MetricsAddr != "" {
+		m = &metrics{progress: opts.Progress}
+		stop, err := startMetricsServer(flags.MetricsAddr, m)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
 
-type floatInfo struct {
-	mantbits uint
-	expbits  uint
-	bias     int
+	phases := phaseTimings{start: start}
+	var results brc.Results
+	if parquetFile != nil {
+		results, err = brc.ProcessParquet(ctx, parquetFile, inputSize(inputs), opts)
+	} else {
+		results, err = brc.ProcessInputsContext(ctx, inputs, opts)
+	}
+	phases.processed = time.Now()
+	if err != nil && ctx.Err() != nil {
+		err = errors.New("interrupted before all measurements were read")
+	}
+	if err != nil && !(flags.Partial && ctx.Err() != nil) {
+		return err
+	}
+	interrupted := err
+	if interrupted != nil {
+		log.Println("interrupted, writing the partial results")
+	}
+
+	log.Println("calculated min/max/mean", time.Since(start))
+	if results.Skipped > 0 && flags.OnError == "collect" {
+		log.Println("skipped", results.Skipped, "malformed lines, written to", flags.BadLines)
+	} else if results.Skipped > 0 {
+		log.Println("skipped", results.Skipped, "malformed lines")
+	}
+	if results.Excluded > 0 {
+		log.Println("excluded", results.Excluded, "readings outside of -min-temp and -max-temp")
+	}
+
+	if flags.Checksum {
+		err = logChecksum(results, flags.ValueAsInt)
+		if err != nil {
+			return err
+		}
+	}
+
+	results = orderResults(results, flags, start)
+	phases.sorted = time.Now()
+
+	err = writeOutputFile(results, flags, time.Since(start))
+	if err != nil {
+		return err
+	}
+
+	log.Println("wrote results", time.Since(start))
+	phases.written = time.Now()
+
+	// the file sizes are only the bytes read when the files were read in full, the progress counts them otherwise
+	bytes := inputSize(inputs)
+	if flags.Offset > 0 || flags.Length > 0 || flags.Limit > 0 || flags.Sample > 0 {
+		bytes = 0
+	}
+	if bytes == 0 && opts.Progress != nil {
+		bytes = opts.Progress.Bytes()
+	}
+	reportThroughput(opts.Timings, bytes, phases.processed.Sub(start))
+	if opts.MapStats != nil {
+		reportMapStats(opts.MapStats)
+	}
+	if m != nil {
+		m.done(results, opts.Timings, phases)
+	}
+
+	if flags.TimingsJSON {
+		err = writeTimings(flags.TimingsOutput, phases, opts.Timings, opts.Progress, results.Skipped)
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.Expected != "" && interrupted == nil {
+		err = checkExpected(os.Stderr, results, flags.ValueAsInt, flags.Expected)
+		if err != nil {
+			return err
+		}
+		log.Println("the results match", flags.Expected)
+	}
+
+	return interrupted
 }
 
-var float64info = floatInfo{52, 11, -1023}
-var float64pow10 = []float64{
-	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9,
-	1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19,
-	1e20, 1e21, 1e22,
+// logChecksum logs the -checksum of the results, which are in the order they were aggregated in
+func logChecksum(results brc.Results, intValues bool) error {
+	sum, err := resultsChecksum(results, intValues)
+	if err != nil {
+		return err
+	}
+	log.Println("checksum sha256:" + sum)
+	return nil
 }
 
-func atof64exact(mantissa uint64, exp int, neg bool) (f float64, ok bool) {
-	if mantissa>>float64info.mantbits != 0 {
-		return
+// autoSize sizes the station tables and read buffers of opts for the stations and line length estimated from a sample
+// of the file, which has to be an uncompressed regular file
+func autoSize(opts *brc.Options, file *os.File, flags CliFlags, start time.Time) error {
+	estimate, err := brc.EstimateFileSeparator(file, flags.Separator)
+	if err != nil {
+		return fmt.Errorf("estimating file failed: %w", err)
+	}
+	log.Println("estimated", estimate.Stations, "stations with a mean line length of", estimate.LineLength, time.Since(start))
+
+	if flags.NumStations == 0 {
+		opts.ExpectedStations = estimate.Stations
 	}
-	f = float64(mantissa)
-	if neg {
-		f = -f
+	opts.BufferSize = min(max(estimate.LineLength*65536, 4096), brc.DefaultBufferSize)
+	if flags.MaxMemory > 0 {
+		return fitMemory(opts, flags.MaxMemory)
 	}
+	return nil
+}
+
+// orderResults puts the stations in the output order of the flags, keeping only the top ones with -top
+func orderResults(results brc.Results, flags CliFlags, start time.Time) brc.Results {
+	// sorted input is already in order of the names
+	inOrder := flags.SortedInput && flags.Sort == "name" && !flags.Desc && flags.Collation == nil
 	switch {
-	case exp == 0:
-		// an integer.
-		return f, true
-	// Exact integers are <= 10^15.
-	// Exact powers of ten are <= 10^22.
-	case exp > 0 && exp <= 15+22: // int * 10^k
-		// If exponent is big but number of digits is not,
-		// can move a few zeros into the integer part.
-		if exp > 22 {
-			f *= float64pow10[exp-22]
-			exp = 22
-		}
-		if f > 1e15 || f < -1e15 {
-			// the exponent was really too large.
-			return
+	case flags.SummaryOnly: // the summary doesn't depend on the order
+	case flags.Top > 0 && (flags.Order == "insertion" || inOrder):
+		results.Stations = results.Stations[:min(flags.Top, len(results.Stations))]
+	case flags.Top > 0:
+		results.Stations = topStations(results.Stations, flags.Sort, flags.Desc, flags.Collation, flags.Top)
+
+		log.Println("selected top", flags.Top, time.Since(start))
+	case flags.Order != "insertion" && !inOrder:
+		sortResults(results, flags.Sort, flags.Desc, flags.Collation)
+
+		log.Println("sorted", time.Since(start))
+	}
+	return results
+}
+
+// writeOutputFile writes the results to the -output file, or to stdout when it isn't set, converted to the -unit
+func writeOutputFile(results brc.Results, flags CliFlags, elapsed time.Duration) error {
+	results = results.Convert(flags.InputUnit, flags.Unit)
+	if flags.Format == "sqlite" {
+		err := writeSQLite(flags.Output, results.Rounded().Stations, outputAggregations(flags))
+		if err != nil {
+			return fmt.Errorf("writing results failed: %w", err)
 		}
-		return f * float64pow10[exp], true
-	case exp < 0 && exp >= -22: // int / 10^k
-		return f / float64pow10[-exp], true
+		return nil
+	}
+
+	write := func(w io.Writer) error {
+		return writeOutput(w, results, flags, elapsed)
+	}
+	var err error
+	if flags.Output == "" {
+		err = write(os.Stdout)
+	} else {
+		err = writeAtomic(flags.Output, write)
 	}
-	return
+	if err != nil {
+		return fmt.Errorf("writing results failed: %w", err)
+	}
+	return nil
 }
 
-// END STDLIB EDITS
+// writeSnapshot writes running results in the output order, leaving the order of the running results alone
+func writeSnapshot(results brc.Results, flags CliFlags, start time.Time) error {
+	results.Stations = slices.Clone(results.Stations)
+	return writeOutputFile(orderResults(results, flags, start), flags, time.Since(start))
+}
 
-func main() {
-	flags, err := parseFlags()
+func sum[T cmp.Ordered](slice []T) T {
+	var sum T
+	for _, v := range slice {
+		sum += v
+	}
+	return sum
+}
+
+var subcommands = map[string]func(args []string) error{
+	"process":  runProcess,
+	"generate": runGenerate,
+	"validate": runValidate,
+	"bench":    runBench,
+	"merge":    runMerge,
+	"serve":    runServe,
+	"consume":  runConsume,
+	"grpc":     runGRPC,
+	"diff":     runDiff,
+}
+
+func runProcess(args []string) error {
+	flags, err := parseProcessFlags(args)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if flags.SelfTest {
+		return runSelfTest()
 	}
 	log.Println("started with args", flags)
 	start := time.Now()
 
-	err = processFile(filepath.Clean(flags.File))
+	paths := make([]string, len(flags.Files))
+	for i, path := range flags.Files {
+		if path != "-" && !isRemote(path) {
+			path = filepath.Clean(path)
+		}
+		paths[i] = path
+	}
+
+	if flags.PprofAddr != "" {
+		stopServer, err := startPprofServer(flags.PprofAddr)
+		if err != nil {
+			return err
+		}
+		defer stopServer()
+	}
+
+	// the first SIGINT or SIGTERM stops the workers, a second one kills the process as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if flags.MaxMemory > 0 {
+		debug.SetMemoryLimit(flags.MaxMemory)
+	}
+
+	stopProfiles, err := startProfiles(flags.CPUProfile, flags.MemProfile)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	switch {
+	case flags.Watch != "":
+		err = watchDir(ctx, flags.Watch, flags)
+	case flags.Follow:
+		err = followFile(ctx, paths[0], flags)
+	case flags.Checkpoint != "" || flags.SnapshotEvery > 0:
+		err = processSegments(ctx, paths[0], flags)
+	default:
+		err = processFiles(ctx, paths, flags)
+	}
+	if stopErr := stopProfiles(); err == nil {
+		err = stopErr
+	}
+	if err != nil {
+		return err
 	}
 	log.Println("finished in", time.Since(start))
+	return nil
+}
+
+func main() {
+	// without a subcommand the arguments are the flags of process
+	run, args := runProcess, os.Args[1:]
+	if len(args) > 0 {
+		if subcommand, ok := subcommands[args[0]]; ok {
+			run, args = subcommand, args[1:]
+		}
+	}
+
+	err := run(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
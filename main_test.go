@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// writeInput writes input to a measurements file in a temporary directory and returns its path
+func writeInput(t *testing.T, input string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// processOutput processes input like the process subcommand with the flags args and returns the output
+func processOutput(t *testing.T, input string, args ...string) string {
+	t.Helper()
+	output, err := goldenOutput(writeInput(t, input), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestValueAsInt(t *testing.T) {
+	input := "A;10\nA;-5\nB;7\nB;8\nC;-3\n"
+
+	for _, workers := range []string{"1", "3"} {
+		got := processOutput(t, input, "-value-as-int", "-workers", workers)
+		want := "{A=-5/2.5/10, B=7/7.5/8, C=-3/-3.0/-3}\n"
+		if got != want {
+			t.Errorf("%s workers: expected %q, got %q", workers, want, got)
+		}
+	}
+
+	got := processOutput(t, input, "-value-as-int", "-format", "json")
+	want := `[{"station":"A","min":-5,"max":10,"mean":2.5,"count":2,"sum":5},{"station":"B","min":7,"max":8,"mean":7.5,"count":2,"sum":15},{"station":"C","min":-3,"max":-3,"mean":-3,"count":1,"sum":-3}]` + "\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestValueAsIntRejectsDecimals(t *testing.T) {
+	_, err := goldenOutput(writeInput(t, "A;10\nA;1.5\n"), []string{"-value-as-int"})
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected the decimal on line 2 to be invalid, got %v", err)
+	}
+}
+
+func TestValueAsIntParserFloat(t *testing.T) {
+	_, err := parseProcessFlags([]string{"-file", "measurements.txt", "-value-as-int", "-parser", "float"})
+	if err == nil {
+		t.Error("expected -value-as-int with -parser float to be rejected")
+	}
+}
+
+func TestColumns(t *testing.T) {
+	// the humidity of B on line 4 is invalid, which leaves out the whole line and not just the humidity
+	input := "A;1.0;50.0\nB;2.0;60.0\nA;3.0;70.0\nB;4.0;xx\nA;-1.0;40.5\n"
+
+	got := processOutput(t, input, "-columns", "name,temp,humidity", "-on-error", "skip")
+	want := "{A=-1.0/1.0/3.0;40.5/53.5/70.0, B=2.0/2.0/2.0;60.0/60.0/60.0}\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	got = processOutput(t, input, "-columns", "name,temp,humidity", "-on-error", "skip", "-format", "json")
+	want = `[{"station":"A","min":-1,"max":3,"mean":1,"count":3,"sum":3,"columns":[{"column":"temp","min":-1,"max":3,"mean":1,"sum":3},{"column":"humidity","min":40.5,"max":70,"mean":53.5,"sum":160.5}]},` +
+		`{"station":"B","min":2,"max":2,"mean":2,"count":1,"sum":2,"columns":[{"column":"temp","min":2,"max":2,"mean":2,"sum":2},{"column":"humidity","min":60,"max":60,"mean":60,"sum":60}]}]` + "\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	_, err := goldenOutput(writeInput(t, input), []string{"-columns", "name,temp,humidity"})
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("expected the invalid humidity on line 4 to fail, got %v", err)
+	}
+}
+
+func TestColumnsExtraValue(t *testing.T) {
+	// line 2 has a value more than -columns declares, like a line with a column too many
+	input := "A;1.0;50.0\nB;2.0;60.0;7.0\nA;3.0;70.0\n"
+
+	got := processOutput(t, input, "-columns", "name,temp,humidity", "-on-error", "skip")
+	want := "{A=1.0/2.0/3.0;50.0/60.0/70.0}\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	_, err := goldenOutput(writeInput(t, input), []string{"-columns", "name,temp,humidity"})
+	if err == nil || !strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), "expected 2 values, got more") {
+		t.Errorf("expected the extra value on line 2 to fail, got %v", err)
+	}
+}
+
+func TestOrderInsertion(t *testing.T) {
+	input := "Zurich;1.0\nAbha;2.0\nMoscow;-3.0\nAbha;4.0\nZurich;10.0\n"
+
+	got := processOutput(t, input, "-order", "insertion", "-workers", "1")
+	want := "{Zurich=1.0/5.5/10.0, Abha=2.0/3.0/4.0, Moscow=-3.0/-3.0/-3.0}\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestOrderInsertionSpill(t *testing.T) {
+	for _, args := range [][]string{{"-spill-stations", "100"}, {"-max-memory", "1GB"}} {
+		_, err := parseProcessFlags(append([]string{"-file", "measurements.txt", "-order", "insertion"}, args...))
+		if err == nil {
+			t.Errorf("expected -order insertion with %v to be rejected", args)
+		}
+	}
+}
+
+func TestSummaryOnly(t *testing.T) {
+	input := "Zurich;1.0\nAbha;2.0\nMoscow;-3.0\nAbha;4.0\nZurich;10.0\n"
+
+	got := processOutput(t, input, "-summary-only")
+	// the rows per second depend on the machine
+	rate := strings.LastIndex(got, "rows/sec: ")
+	if rate < 0 {
+		t.Fatalf("expected a rows/sec line, got %q", got)
+	}
+	want := "rows: 5\nstations: 3\nmin: -3.0\nmax: 10.0\nmean: 2.8\n"
+	if got[:rate] != want {
+		t.Errorf("expected %q, got %q", want, got[:rate])
+	}
+	for _, station := range []string{"Zurich", "Abha", "Moscow"} {
+		if strings.Contains(got, station) {
+			t.Errorf("expected no per station results, got %q", got)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summary := summarize([]*brc.StationResult{
+		{Station: "Abha", Min: 2, Max: 4, Mean: 3, Readings: 2, Sum: 6},
+		{Station: "Moscow", Min: -3, Max: -3, Mean: -3, Readings: 1, Sum: -3},
+		{Station: "Zurich", Min: 1, Max: 10, Mean: 5.5, Readings: 2, Sum: 11},
+	}, 0)
+
+	want := Summary{Rows: 5, Stations: 3, Min: -3, Max: 10, Mean: 2.8}
+	if summary != want {
+		t.Errorf("expected %+v, got %+v", want, summary)
+	}
+	// the mean comes from the exact sums, not from the means of the stations which may be rounded
+	summary = summarize([]*brc.StationResult{{Station: "Oslo", Min: 0, Max: 1, Mean: 0.3, Readings: 3, Sum: 1}}, 0)
+	if summary.Mean != 1.0/3 {
+		t.Errorf("expected a mean of 1/3, got %v", summary.Mean)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	input := "Paris-01;10.0\nLyon;5.0\nParis-02;20.0\nParis-01;-4.0\nParis;1.0\n"
+
+	for _, variant := range goldenVariants {
+		args := append([]string{"-rewrite", `^Paris-\d+$=>Paris`, "-format", "json"}, variant...)
+		got := processOutput(t, input, args...)
+		want := `[{"station":"Lyon","min":5,"max":5,"mean":5,"count":1,"sum":5},{"station":"Paris","min":-4,"max":20,"mean":6.8,"count":4,"sum":27}]` + "\n"
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", strings.Join(variant, " "), want, got)
+		}
+	}
+}
+
+func TestConcatStdin(t *testing.T) {
+	file := "Paris;10.0\nLyon;5.0\nParis;-4.0\n"
+	piped := "Lyon;12.5\nNice;20.0\nParis;30.0\n"
+	want := processOutput(t, file+piped, "-format", "json")
+
+	path := writeInput(t, file)
+	for _, variant := range goldenVariants {
+		got, err := pipedOutput(t, []byte(piped), path, append([]string{"-concat-stdin", "-format", "json"}, variant...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected %q, got %q", strings.Join(variant, " "), want, got)
+		}
+	}
+}
+
+func TestConcatStdinCompression(t *testing.T) {
+	file := "Paris;10.0\nLyon;5.0\nParis;-4.0\n"
+	piped := "Lyon;12.5\nNice;20.0\nParis;30.0\n"
+	want := processOutput(t, file+piped)
+
+	// the file is named like an uncompressed one, -compression applies to stdin like to the file
+	path := writeInput(t, string(gzipped(t, file)))
+	got, err := pipedOutput(t, gzipped(t, piped), path, []string{"-concat-stdin", "-compression", "gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// with -compression none the gzip stream is read as lines like the file
+	_, err = pipedOutput(t, gzipped(t, piped), writeInput(t, file), []string{"-concat-stdin", "-compression", "none"})
+	if err == nil {
+		t.Error("expected the gzip stream on stdin to be read as malformed lines with -compression none")
+	}
+}
+
+// pipedOutput is goldenOutput with piped written to stdin through a pipe
+func pipedOutput(t *testing.T, piped []byte, path string, args []string) ([]byte, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		w.Write(piped)
+		w.Close()
+	}()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+
+	return goldenOutput(path, args)
+}
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte(data))
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJSONPretty(t *testing.T) {
+	input := "Zurich;1.0\nAbha;2.0\nMoscow;-3.0\nAbha;4.0\nZurich;10.0\n"
+
+	compact := processOutput(t, input, "-format", "json")
+	pretty := processOutput(t, input, "-format", "json", "-json-pretty")
+	if strings.Count(compact, "\n") != 1 {
+		t.Errorf("expected the compact output on a single line, got %q", compact)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(pretty)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String()+"\n" != compact {
+		t.Errorf("expected the pretty output to be the compact output indented, got %q and %q", pretty, compact)
+	}
+
+	_, err := parseProcessFlags([]string{"-file", "measurements.txt", "-json-pretty"})
+	if err == nil {
+		t.Error("expected -json-pretty without -format json to be rejected")
+	}
+}
+
+func TestErrorSample(t *testing.T) {
+	var input strings.Builder
+	for i := range 100 {
+		fmt.Fprintf(&input, "Abha;1.0\nbad %d\nbad 0\n", i)
+	}
+	path := writeInput(t, input.String())
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	output, err := goldenOutput(path, []string{"-on-error", "skip", "-error-sample", "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{Abha=1.0/1.0/1.0}\n"; string(output) != want {
+		t.Errorf("expected %q, got %q", want, output)
+	}
+
+	if logged := strings.Count(logs.String(), "malformed line: "); logged != 5 {
+		t.Errorf("expected 5 logged malformed lines, got %d in %s", logged, logs.String())
+	}
+	for _, want := range []string{`malformed line: "bad 0"`, `malformed line: "bad 4"`, "...and 95 more malformed lines", "skipped 200 malformed lines"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected %q to be logged, got %s", want, logs.String())
+		}
+	}
+}
+
+// loggedChecksum processes input with -checksum and the flags args and returns the logged checksum
+func loggedChecksum(t *testing.T, input string, args ...string) string {
+	t.Helper()
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	processOutput(t, input, append([]string{"-checksum"}, args...)...)
+	_, sum, ok := strings.Cut(logs.String(), "checksum sha256:")
+	if !ok {
+		t.Fatalf("expected the checksum to be logged, got %s", logs.String())
+	}
+	sum, _, _ = strings.Cut(sum, "\n")
+	return sum
+}
+
+func TestChecksum(t *testing.T) {
+	input := "Cairo;20.0\nAbha;5.0\nBerlin;-3.2\nAbha;7.0\n"
+	want := loggedChecksum(t, input)
+
+	sum := sha256.Sum256([]byte(processOutput(t, input)))
+	if hex.EncodeToString(sum[:]) != want {
+		t.Errorf("expected the checksum %s to be the sha256 of the default output", want)
+	}
+
+	// the order of the input and the output flags don't change the results
+	reordered := "Berlin;-3.2\nAbha;7.0\nCairo;20.0\nAbha;5.0\n"
+	for _, args := range [][]string{{}, {"-workers", "3"}, {"-sort", "mean", "-format", "json"}, {"-top", "1"}} {
+		if got := loggedChecksum(t, reordered, args...); got != want {
+			t.Errorf("%v: expected checksum %s, got %s", args, want, got)
+		}
+	}
+
+	if got := loggedChecksum(t, "Cairo;20.0\nAbha;5.0\nBerlin;-3.3\nAbha;7.0\n"); got == want {
+		t.Error("expected a changed reading to change the checksum")
+	}
+}
+
+func TestMapStatsSegments(t *testing.T) {
+	path := writeInput(t, "Abha;1.0\nBerlin;-2.5\nCairo;30.0\nAbha;3.0\n")
+	flags, err := parseProcessFlags([]string{"-file", path, "-checkpoint", filepath.Join(t.TempDir(), "checkpoint"), "-dump-map-stats", "-workers", "1", "-output", filepath.Join(t.TempDir(), "results.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	err = processSegments(context.Background(), path, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "station tables: 1 tables with 3 stations"; !strings.Contains(logs.String(), want) {
+		t.Errorf("expected %q to be logged, got %s", want, logs.String())
+	}
+}
+
+func TestNumberLocale(t *testing.T) {
+	input := "Abha;1234.5\nAbha;-10.0\nZurich;-2.5\n"
+	for _, tt := range []struct {
+		locale string
+		want   string
+	}{
+		{"", "station\tmin\tmean\tmax\tcount\tsum\nAbha\t-10.0\t612.3\t1234.5\t2\t1224.5\nZurich\t-2.5\t-2.5\t-2.5\t1\t-2.5\n"},
+		{"en", "station\tmin\tmean\tmax\tcount\tsum\nAbha\t-10.0\t612.3\t1,234.5\t2\t1,224.5\nZurich\t-2.5\t-2.5\t-2.5\t1\t-2.5\n"},
+		{"de", "station\tmin\tmean\tmax\tcount\tsum\nAbha\t-10,0\t612,3\t1.234,5\t2\t1.224,5\nZurich\t-2,5\t-2,5\t-2,5\t1\t-2,5\n"},
+	} {
+		args := []string{"-format", "tsv", "-agg", "min,mean,max,count,sum"}
+		if tt.locale != "" {
+			args = append(args, "-number-locale", tt.locale)
+		}
+		if got := processOutput(t, input, args...); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.locale, tt.want, got)
+		}
+	}
+
+	for _, args := range [][]string{{"-number-locale", "de"}, {"-number-locale", "de", "-format", "json"}, {"-number-locale", "not a tag", "-format", "csv"}} {
+		if _, err := parseProcessFlags(append([]string{"-file", "measurements.txt"}, args...)); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestSummaryOnlySQLite(t *testing.T) {
+	_, err := parseProcessFlags([]string{"-file", "measurements.txt", "-summary-only", "-format", "sqlite", "-output", "results.db"})
+	if err == nil {
+		t.Error("expected -summary-only with -format sqlite to be rejected")
+	}
+}
+
+func TestSummaryOnlyFormats(t *testing.T) {
+	input := "Zurich;1.0\nAbha;2.0\nMoscow;-3.0\nAbha;4.0\nZurich;10.0\n"
+
+	var summary Summary
+	if err := json.Unmarshal([]byte(processOutput(t, input, "-summary-only", "-format", "json")), &summary); err != nil {
+		t.Fatal(err)
+	}
+	summary.RowsPerSecond = 0 // depends on the machine
+	if want := (Summary{Rows: 5, Stations: 3, Min: -3, Max: 10, Mean: 2.8}); summary != want {
+		t.Errorf("expected %+v, got %+v", want, summary)
+	}
+
+	// the rows per second in the last column depend on the machine
+	got := processOutput(t, input, "-summary-only", "-format", "tsv")
+	want := "rows\tstations\tmin\tmax\tmean\trows_per_second\n5\t3\t-3.0\t10.0\t2.8\t"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("expected %q to start with %q", got, want)
+	}
+
+	got = processOutput(t, strings.ReplaceAll(input, ".0", ""), "-summary-only", "-value-as-int")
+	want = "rows: 5\nstations: 3\nmin: -3\nmax: 10\nmean: 2.8\n"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("expected %q to start with %q", got, want)
+	}
+
+	for _, format := range []string{"parquet", "arrow"} {
+		if _, err := parseProcessFlags([]string{"-file", "measurements.txt", "-summary-only", "-format", format}); err == nil {
+			t.Errorf("expected -summary-only with -format %s to be rejected", format)
+		}
+	}
+}
+
+func TestChecksumSegments(t *testing.T) {
+	input := "Cairo;20.0\nAbha;5.0\nBerlin;-3.2\nAbha;7.0\n"
+	want := loggedChecksum(t, input)
+
+	path := writeInput(t, input)
+	flags, err := parseProcessFlags([]string{"-file", path, "-checkpoint", filepath.Join(t.TempDir(), "checkpoint"), "-checksum", "-output", filepath.Join(t.TempDir(), "results.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	err = processSegments(context.Background(), path, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "checksum sha256:"+want+"\n") {
+		t.Errorf("expected checksum %s to be logged, got %s", want, logs.String())
+	}
+}
+
+func TestSegmentsLineNumbers(t *testing.T) {
+	defer func(size int64) { segmentSize = size }(segmentSize)
+	segmentSize = 20
+
+	// the segments are 20 bytes, two lines each, so line 7 is in the fourth segment
+	input := "Abha;1.0\nAbha;2.0\nAbha;3.0\nAbha;4.0\nAbha;5.0\nAbha;6.0\nAbha;xx\nAbha;8.0\n"
+	path := writeInput(t, input)
+	flags, err := parseProcessFlags([]string{"-file", path, "-checkpoint", filepath.Join(t.TempDir(), "checkpoint"), "-output", filepath.Join(t.TempDir(), "results.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	err = processSegments(context.Background(), path, flags)
+	if err == nil || !strings.Contains(err.Error(), "line 7:") {
+		t.Errorf("expected the invalid reading on line 7 to fail, got %v", err)
+	}
+}
+
+func TestFollowLineNumbers(t *testing.T) {
+	path := writeInput(t, "Abha;1.0\nAbha;2.0\nAbha;3.0\n")
+	flags, err := parseProcessFlags([]string{"-file", path, "-follow", "-output", filepath.Join(t.TempDir(), "results.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- followFile(ctx, path, flags)
+	}()
+
+	// appended once the first lines are read, so it is read from an offset
+	time.Sleep(2 * followPollInterval)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("Abha;4.0\nAbha;xx\n")
+	file.Close()
+
+	err = <-done
+	if err == nil || !strings.Contains(err.Error(), "line 5:") {
+		t.Errorf("expected the invalid reading on line 5 to fail, got %v", err)
+	}
+}
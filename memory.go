@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// Rough sizes of what processing keeps in memory, to fit it in a -max-memory budget
+const (
+	minBufferSize     = 64 * 1024
+	stationBytes      = 160  // a station in the table of a chunk: its entry, slot, name and aggregate
+	sketchBytes       = 2048 // the sketch of a station for the percentiles, depending on the spread of its readings
+	bufferShare       = 4    // the read buffers get a quarter of the budget
+	stationTableShare = 2    // the station tables of the chunks and the merged stations get half of it
+)
+
+// parseSize parses a size like 512MB or 2GiB into bytes, the units being powers of 1024 either way
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	}
+	number, unit := strings.ToUpper(s), int64(1)
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(number, strings.ToUpper(u.suffix)); ok {
+			number, unit = n, u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a size like 512MB or 2GB", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// fitMemory sizes the read buffers, the number of chunks and the station tables of opts to fit in budget bytes.
+// The chunks get smaller buffers first and are reduced in number once the buffers are at their minimum, and the
+// stations are spilled to disk once the tables would outgrow their share, when the options allow spilling.
+func fitMemory(opts *brc.Options, budget int64) error {
+	buffers := budget / bufferShare
+	if buffers < minBufferSize {
+		return errors.New("-max-memory is too small to read with")
+	}
+
+	bufSize := int64(opts.BufferSize)
+	if bufSize <= 0 {
+		bufSize = brc.DefaultBufferSize
+	}
+	bufSize = min(bufSize, buffers/int64(opts.Workers))
+	if bufSize < minBufferSize {
+		bufSize = minBufferSize
+		opts.Workers = int(buffers / minBufferSize)
+	}
+	opts.BufferSize = int(bufSize)
+
+	if opts.SortedInput || len(opts.Columns) > 1 || opts.Rewrite != nil || opts.Normalize != 0 || opts.MergeStrategy == brc.MergeSharded {
+		return nil // these can't spill, sorted input only holds a station at a time anyway
+	}
+
+	perStation := int64(stationBytes)
+	if len(opts.Percentiles) > 0 {
+		perStation += sketchBytes
+	}
+	if opts.Histogram {
+		perStation += brc.HistogramBuckets * 8
+	}
+
+	// every chunk has a table, and the merged stations take about as much as one of them
+	spillStations := int(budget / stationTableShare / perStation / int64(opts.Workers+1))
+	if spillStations == 0 {
+		return errors.New("-max-memory is too small to hold a station")
+	}
+	if opts.SpillStations == 0 || opts.SpillStations > spillStations {
+		opts.SpillStations = spillStations
+	}
+	opts.ExpectedStations = min(opts.ExpectedStations, opts.SpillStations)
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+type MergeFlags struct {
+	Files []string
+	Order string
+	OutputFlags
+}
+
+func parseMergeFlags(args []string) (MergeFlags, error) {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go_1brc merge [flags] results.json...")
+		fs.PrintDefaults()
+	}
+	order := fs.String("order", "sorted", "output order of the stations: sorted or insertion (first seen in the files)")
+	outputFlags := registerOutputFlags(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return MergeFlags{}, err
+	}
+
+	if fs.NArg() == 0 {
+		return MergeFlags{}, errors.New("no result files specified")
+	}
+	if *order != "sorted" && *order != "insertion" {
+		return MergeFlags{}, fmt.Errorf("unknown order %q", *order)
+	}
+
+	output, err := outputFlags()
+	if err != nil {
+		return MergeFlags{}, err
+	}
+
+	return MergeFlags{fs.Args(), *order, output}, nil
+}
+
+// runMerge combines results written with -format json, for example of separate parts of a file, into the
+// results of the whole
+func runMerge(args []string) error {
+	flags, err := parseMergeFlags(args)
+	if err != nil {
+		return err
+	}
+
+	var results brc.Results
+	for _, path := range flags.Files {
+		part, err := readJSONResults(path)
+		if err != nil {
+			return err
+		}
+		for _, problem := range inconsistencies(part) {
+			log.Printf("warning: %s: %s", path, problem)
+		}
+		results.Merge(part)
+	}
+	log.Println("merged", len(flags.Files), "files into", len(results.Stations), "stations")
+
+	if flags.Order != "insertion" {
+		results.Sort()
+	}
+
+	// keep the standard deviation and histograms when the merged results had them
+	outputFlags := CliFlags{OutputFlags: flags.OutputFlags}
+	outputFlags.Aggregations = defaultAggregations(flags.Format)
+	if slices.ContainsFunc(results.Stations, func(s *brc.StationResult) bool { return s.SumSquares != 0 }) {
+		outputFlags.Aggregations = append(outputFlags.Aggregations, "stddev")
+	}
+	if flags.Unit == flags.InputUnit && slices.ContainsFunc(results.Stations, func(s *brc.StationResult) bool { return s.Histogram != nil }) {
+		outputFlags.Aggregations = append(outputFlags.Aggregations, "histogram")
+	}
+
+	return writeOutputFile(results, outputFlags, 0)
+}
+
+func readJSONResults(path string) (brc.Results, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return brc.Results{}, fmt.Errorf("opening file for reading failed: %w", err)
+	}
+	defer file.Close()
+
+	var stations []jsonStation
+	err = json.NewDecoder(file).Decode(&stations)
+	if err != nil {
+		return brc.Results{}, fmt.Errorf("%s: decoding results failed: %w", path, err)
+	}
+
+	results := brc.Results{Stations: make([]*brc.StationResult, 0, len(stations))}
+	for _, s := range stations {
+		if s.Min == nil || s.Max == nil || s.Count == nil || s.Sum == nil {
+			return brc.Results{}, fmt.Errorf("%s: %s lacks the min, max, count or sum needed to merge it, write the results without -agg or include them", path, s.Station)
+		}
+		result := &brc.StationResult{Station: s.Station, Min: *s.Min, Max: *s.Max, Readings: *s.Count, Sum: *s.Sum}
+		result.Mean = result.Sum / float64(result.Readings)
+		if s.StdDev != nil && s.SumSquares != nil {
+			result.StdDev, result.SumSquares = *s.StdDev, *s.SumSquares
+		}
+		if s.Histogram != nil {
+			result.Histogram = make([]uint64, brc.HistogramBuckets)
+			for _, b := range s.Histogram {
+				if b.Min < brc.HistogramMin || b.Min >= brc.HistogramMax {
+					return brc.Results{}, fmt.Errorf("%s: histogram bucket %d of %s is out of range", path, b.Min, s.Station)
+				}
+				result.Histogram[b.Min-brc.HistogramMin] += b.Count
+			}
+		}
+		for _, c := range s.Columns {
+			result.Columns = append(result.Columns, brc.ColumnResult{Column: c.Column, Min: c.Min, Max: c.Max, Mean: c.Mean, Sum: c.Sum})
+		}
+		results.Stations = append(results.Stations, result)
+	}
+	return results, nil
+}
+
+// roundingTolerance is how far the min and max written with one decimal can be from the readings they were rounded from
+const roundingTolerance = 0.05
+
+// inconsistencies describes the stations of a shard whose statistics contradict each other: a min above the max, or a
+// count and sum whose mean lies outside of them. They can't come from aggregating readings and usually mean the shard
+// was parsed wrongly or written in another unit, so the merged results of the station are wrong too.
+func inconsistencies(results brc.Results) []string {
+	var problems []string
+	for _, s := range results.Stations {
+		switch {
+		case s.Min > s.Max:
+			problems = append(problems, fmt.Sprintf("%s has a min of %.1f above its max of %.1f", s.Station, s.Min, s.Max))
+		case s.Readings <= 0:
+			problems = append(problems, fmt.Sprintf("%s has a count of %d", s.Station, s.Readings))
+		case s.Mean < s.Min-roundingTolerance || s.Mean > s.Max+roundingTolerance:
+			problems = append(problems, fmt.Sprintf("%s has a count of %d and sum of %.1f, a mean of %.1f outside of its min %.1f and max %.1f", s.Station, s.Readings, s.Sum, s.Mean, s.Min, s.Max))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+func TestMergeInconsistentShard(t *testing.T) {
+	dir := t.TempDir()
+	shards := []string{
+		`[{"station":"Abha","min":-1.0,"max":5.0,"mean":2.0,"count":2,"sum":4.0},{"station":"Cairo","min":10.0,"max":20.0,"mean":15.0,"count":2,"sum":30.0}]`,
+		// Abha has its min and max swapped, the readings of Cairo were summed in Fahrenheit
+		`[{"station":"Abha","min":6.0,"max":2.0,"mean":4.0,"count":2,"sum":8.0},{"station":"Cairo","min":12.0,"max":18.0,"mean":59.0,"count":2,"sum":118.0}]`,
+	}
+	var args []string
+	for i, shard := range shards {
+		path := filepath.Join(dir, fmt.Sprintf("part%d.json", i+1))
+		if err := os.WriteFile(path, []byte(shard), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, path)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	output := filepath.Join(dir, "merged.txt")
+	err := runMerge(append([]string{"-output", output}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"warning: " + args[1],
+		"Abha has a min of 6.0 above its max of 2.0",
+		"Cairo has a count of 2 and sum of 118.0, a mean of 59.0 outside of its min 12.0 and max 18.0",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected %q to be logged, got %s", want, logs.String())
+		}
+	}
+	if strings.Count(logs.String(), "warning: ") != 2 {
+		t.Errorf("expected only the stations of part2.json to be warned about, got %s", logs.String())
+	}
+}
+
+func TestInconsistenciesRounding(t *testing.T) {
+	// the mean of readings can lie just outside of their min and max rounded to one decimal
+	results := brc.Results{Stations: []*brc.StationResult{{Station: "Abha", Min: 1.0, Max: 1.0, Mean: 1.04, Readings: 2, Sum: 2.08}}}
+	if problems := inconsistencies(results); len(problems) > 0 {
+		t.Errorf("expected no inconsistencies, got %v", problems)
+	}
+}
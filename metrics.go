@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// metrics exposes the progress of processing in the Prometheus text format. The counters of the progress are live,
+// the malformed lines, stations and phase durations are set once processing is done.
+type metrics struct {
+	progress *brc.Progress
+
+	mu       sync.Mutex
+	skipped  int
+	stations int
+	phases   []phaseDuration
+}
+
+type phaseDuration struct {
+	phase   string
+	seconds float64
+}
+
+// done sets the metrics only known once processing is done
+func (m *metrics) done(results brc.Results, timings *brc.Timings, phases phaseTimings) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.skipped = results.Skipped
+	m.stations = len(results.Stations)
+	m.phases = []phaseDuration{
+		{"aggregate", timings.Aggregate().Seconds()},
+		{"merge", timings.Merge().Seconds()},
+		{"sort", phases.sorted.Sub(phases.processed).Seconds()},
+		{"write", phases.written.Sub(phases.sorted).Seconds()},
+		{"total", phases.written.Sub(phases.start).Seconds()},
+	}
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP go_1brc_bytes_read_total Bytes of measurements read, line endings included.")
+	fmt.Fprintln(w, "# TYPE go_1brc_bytes_read_total counter")
+	fmt.Fprintln(w, "go_1brc_bytes_read_total", m.progress.Bytes())
+	fmt.Fprintln(w, "# HELP go_1brc_rows_read_total Lines of measurements read.")
+	fmt.Fprintln(w, "# TYPE go_1brc_rows_read_total counter")
+	fmt.Fprintln(w, "go_1brc_rows_read_total", m.progress.Rows())
+	fmt.Fprintln(w, "# HELP go_1brc_malformed_lines_total Malformed lines skipped, set once processing is done.")
+	fmt.Fprintln(w, "# TYPE go_1brc_malformed_lines_total counter")
+	fmt.Fprintln(w, "go_1brc_malformed_lines_total", m.skipped)
+	fmt.Fprintln(w, "# HELP go_1brc_stations Stations in the results, set once processing is done.")
+	fmt.Fprintln(w, "# TYPE go_1brc_stations gauge")
+	fmt.Fprintln(w, "go_1brc_stations", m.stations)
+	if len(m.phases) > 0 {
+		fmt.Fprintln(w, "# HELP go_1brc_phase_duration_seconds Wall time of the phases of processing.")
+		fmt.Fprintln(w, "# TYPE go_1brc_phase_duration_seconds gauge")
+		for _, p := range m.phases {
+			fmt.Fprintf(w, "go_1brc_phase_duration_seconds{phase=%q} %g\n", p.phase, p.seconds)
+		}
+	}
+}
+
+// startMetricsServer serves the metrics on addr at /metrics until the returned stop function is called
+func startMetricsServer(addr string, m *metrics) (stop func(), err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("starting metrics server failed: %w", err)
+	}
+	log.Printf("serving metrics on http://%s/metrics", listener.Addr())
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	server := &http.Server{Handler: mux}
+	go func() {
+		err := server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Println("metrics server failed:", err)
+		}
+	}()
+
+	return func() { server.Close() }, nil
+}
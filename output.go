@@ -0,0 +1,560 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/message"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// writeOutput writes the results, or only their summary, in the format selected by the flags
+func writeOutput(w io.Writer, results brc.Results, flags CliFlags, elapsed time.Duration) error {
+	if flags.SummaryOnly {
+		return writeSummary(w, summarize(results.Stations, elapsed), flags)
+	}
+
+	results = results.Rounded()
+	aggregations := outputAggregations(flags)
+	switch flags.Format {
+	case "json":
+		return writeJSON(w, results.Stations, aggregations, flags.Pretty)
+	case "parquet":
+		return writeParquet(w, results.Stations, aggregations)
+	case "arrow":
+		return writeArrow(w, results.Stations, aggregations)
+	case "csv", "tsv":
+		return writeCSV(w, results.Stations, flags.Delimiter, numberFormat{flags.ValueAsInt, flags.NumberLocale}, aggregations)
+	default:
+		return writeResults(w, results.Stations, flags.ValueAsInt, aggregations)
+	}
+}
+
+// sortResults sorts the stations by the statistic named key, stations with the same value are sorted by name in the
+// same direction. Names are compared with the collation, or byte by byte when it is nil.
+func sortResults(results brc.Results, key string, desc bool, collation *collate.Collator) {
+	if key == "name" && !desc && collation == nil {
+		results.Sort()
+		return
+	}
+	slices.SortFunc(results.Stations, compareBy(key, desc, collation))
+}
+
+// topStations returns the first n stations in the order of sortResults, it only keeps n stations in a heap instead
+// of sorting all of them
+func topStations(stations []*brc.StationResult, key string, desc bool, collation *collate.Collator, n int) []*brc.StationResult {
+	h := &stationHeap{compare: compareBy(key, desc, collation)}
+	for _, s := range stations {
+		if len(h.stations) < n {
+			heap.Push(h, s)
+		} else if h.compare(s, h.stations[0]) < 0 {
+			h.stations[0] = s
+			heap.Fix(h, 0)
+		}
+	}
+
+	slices.SortFunc(h.stations, h.compare)
+	return h.stations
+}
+
+// stationHeap keeps the last station in the order of compare on top, so it is the first one to be replaced
+type stationHeap struct {
+	stations []*brc.StationResult
+	compare  func(a *brc.StationResult, b *brc.StationResult) int
+}
+
+func (h *stationHeap) Len() int           { return len(h.stations) }
+func (h *stationHeap) Less(i, j int) bool { return h.compare(h.stations[i], h.stations[j]) > 0 }
+func (h *stationHeap) Swap(i, j int)      { h.stations[i], h.stations[j] = h.stations[j], h.stations[i] }
+func (h *stationHeap) Push(x any)         { h.stations = append(h.stations, x.(*brc.StationResult)) }
+
+func (h *stationHeap) Pop() any {
+	last := h.stations[len(h.stations)-1]
+	h.stations = h.stations[:len(h.stations)-1]
+	return last
+}
+
+// compareBy compares stations by the statistic named key, stations with the same value are compared by name with the
+// collation. Names the collation sees as equal, or all names when it is nil, are compared byte by byte.
+func compareBy(key string, desc bool, collation *collate.Collator) func(a *brc.StationResult, b *brc.StationResult) int {
+	// sorting by name leaves every value 0, so the tie-break on the name decides the order
+	value := func(r *brc.StationResult) float64 {
+		switch key {
+		case "min":
+			return r.Min
+		case "max":
+			return r.Max
+		case "mean":
+			return r.Mean
+		case "count":
+			return float64(r.Readings)
+		default:
+			return 0
+		}
+	}
+	return func(a *brc.StationResult, b *brc.StationResult) int {
+		c := cmp.Compare(value(a), value(b))
+		if c == 0 && collation != nil {
+			c = collation.CompareString(a.Station, b.Station)
+		}
+		if c == 0 {
+			c = strings.Compare(a.Station, b.Station)
+		}
+		if desc {
+			return -c
+		}
+		return c
+	}
+}
+
+// outputAggregations returns the statistics written with the flags, those of -agg or the default of the format
+func outputAggregations(flags CliFlags) []string {
+	if flags.Aggregations == nil {
+		return defaultAggregations(flags.Format)
+	}
+	return flags.Aggregations
+}
+
+// defaultAggregations returns the statistics written in the format when -agg isn't given
+func defaultAggregations(format string) []string {
+	switch format {
+	case "json", "parquet", "sqlite", "arrow":
+		return []string{"min", "max", "mean", "count", "sum"}
+	case "csv", "tsv":
+		return []string{"min", "mean", "max", "count"}
+	default:
+		return []string{"min", "mean", "max"}
+	}
+}
+
+// formatStats formats every aggregation of the station in the order they were given in, except for the histogram
+// which is only written in the json format. The percentiles of the station are in the same order as the percentile
+// aggregations.
+func formatStats(r *brc.StationResult, aggregations []string, format numberFormat) []string {
+	stats := make([]string, 0, len(aggregations))
+	percentile := 0
+	for _, a := range aggregations {
+		switch a {
+		case "min":
+			stats = append(stats, format.reading(r.Min))
+		case "max":
+			stats = append(stats, format.reading(r.Max))
+		case "mean":
+			stats = append(stats, format.decimal(r.Mean))
+		case "count":
+			stats = append(stats, format.count(r.Readings))
+		case "sum":
+			stats = append(stats, format.reading(r.Sum))
+		case "stddev":
+			stats = append(stats, format.decimal(r.StdDev))
+		case "histogram":
+		default:
+			if percentile < len(r.Percentiles) {
+				stats = append(stats, format.reading(r.Percentiles[percentile].Value))
+			}
+			percentile++
+		}
+	}
+	return stats
+}
+
+// statColumn is a column of the formats with typed columns, in which the value of every station is a float64 or, for
+// integer columns, an int
+type statColumn struct {
+	name    string
+	integer bool
+}
+
+// statColumns returns the typed columns of the aggregations after the station, with multiple value columns every
+// column gets its own min, mean and max columns
+func statColumns(results []*brc.StationResult, aggregations []string) []statColumn {
+	var columns []statColumn
+	if len(results) > 0 && len(results[0].Columns) > 0 {
+		for _, c := range results[0].Columns {
+			columns = append(columns, statColumn{c.Column + "_min", false}, statColumn{c.Column + "_mean", false}, statColumn{c.Column + "_max", false})
+		}
+		return append(columns, statColumn{"count", true})
+	}
+
+	for _, a := range aggregations {
+		if a != "histogram" {
+			columns = append(columns, statColumn{a, a == "count"})
+		}
+	}
+	return columns
+}
+
+// statValues returns the values of the station in the order of statColumns, nil for a percentile that wasn't estimated
+func statValues(r *brc.StationResult, aggregations []string) []any {
+	var values []any
+	if len(r.Columns) > 0 {
+		for _, c := range r.Columns {
+			values = append(values, c.Min, c.Mean, c.Max)
+		}
+		return append(values, r.Readings)
+	}
+
+	percentile := 0
+	for _, a := range aggregations {
+		switch a {
+		case "min":
+			values = append(values, r.Min)
+		case "max":
+			values = append(values, r.Max)
+		case "mean":
+			values = append(values, r.Mean)
+		case "count":
+			values = append(values, r.Readings)
+		case "sum":
+			values = append(values, r.Sum)
+		case "stddev":
+			values = append(values, r.StdDev)
+		case "histogram":
+		default:
+			var value any
+			if percentile < len(r.Percentiles) {
+				value = r.Percentiles[percentile].Value
+			}
+			values = append(values, value)
+			percentile++
+		}
+	}
+	return values
+}
+
+// numberFormat formats the numbers of the text formats. Readings have one decimal, or none for integer values. With a
+// printer the numbers get the decimal and grouping separators of its language, like 1.234,5 for German, otherwise
+// they are formatted like strconv does for the formats meant to be parsed.
+type numberFormat struct {
+	intValues bool
+	printer   *message.Printer
+}
+
+func (f numberFormat) reading(v float64) string {
+	if f.intValues {
+		return f.float(v, 0)
+	}
+	return f.float(v, 1)
+}
+
+// decimal formats a statistic which has a decimal even for integer values, like the mean
+func (f numberFormat) decimal(v float64) string {
+	return f.float(v, 1)
+}
+
+func (f numberFormat) float(v float64, decimals int) string {
+	if f.printer != nil {
+		return f.printer.Sprintf("%.*f", decimals, v)
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+func (f numberFormat) count(n int) string {
+	if f.printer != nil {
+		return f.printer.Sprintf("%d", n)
+	}
+	return strconv.Itoa(n)
+}
+
+// writeAtomic writes to a temporary file next to path which only replaces path once write succeeded,
+// so path never contains partial results
+func writeAtomic(path string, write func(io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // fails once renamed
+
+	bw := bufio.NewWriter(file)
+	err = write(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// writeResults writes the results in the 1BRC format: {Abha=-23.0/18.0/59.2, Abidjan=-16.2/26.0/67.3, ...}
+// Every station has the aggregations in order, for min,max,p99: Abha=-23.0/59.2/41.3
+func writeResults(w io.Writer, results []*brc.StationResult, intValues bool, aggregations []string) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('{')
+	for i, r := range results {
+		if i > 0 {
+			bw.WriteString(", ")
+		}
+		bw.WriteString(r.Station)
+		bw.WriteByte('=')
+		if len(r.Columns) == 0 {
+			bw.WriteString(strings.Join(formatStats(r, aggregations, numberFormat{intValues: intValues}), "/"))
+			continue
+		}
+
+		for c, column := range r.Columns {
+			if c > 0 {
+				bw.WriteByte(';')
+			}
+			bw.WriteString(strings.Join(formatReadings(column.Min, column.Mean, column.Max, numberFormat{intValues: intValues}), "/"))
+		}
+	}
+	bw.WriteString("}\n")
+
+	return bw.Flush()
+}
+
+// resultsChecksum returns the hex SHA-256 of the results in the output format of the challenge sorted by name, the
+// canonical output which doesn't depend on the output flags. It is the sha256sum of the output of a default run.
+func resultsChecksum(results brc.Results, intValues bool) (string, error) {
+	stations := slices.Clone(results.Rounded().Stations)
+	brc.Results{Stations: stations}.Sort()
+
+	h := sha256.New()
+	err := writeResults(h, stations, intValues, defaultAggregations("brc"))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// jsonStation has a field per aggregation, the ones that aren't selected are left out. It is also the row of the
+// parquet format, where they are null.
+type jsonStation struct {
+	Station string       `json:"station" parquet:"station"`
+	Min     *float64     `json:"min,omitempty" parquet:"min,optional"`
+	Max     *float64     `json:"max,omitempty" parquet:"max,optional"`
+	Mean    *float64     `json:"mean,omitempty" parquet:"mean,optional"`
+	Count   *int         `json:"count,omitempty" parquet:"count,optional"`
+	Sum     *float64     `json:"sum,omitempty" parquet:"sum,optional"`
+	Columns []jsonColumn `json:"columns,omitempty" parquet:"columns,list"`
+
+	StdDev      *float64           `json:"stddev,omitempty" parquet:"stddev,optional"`
+	SumSquares  *float64           `json:"sum_squares,omitempty" parquet:"sum_squares,optional"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty" parquet:"percentiles,optional"`
+	Histogram   []jsonBucket       `json:"histogram,omitempty" parquet:"histogram,list"`
+}
+
+// jsonBucket is a histogram bucket, counting the readings from min up to max
+type jsonBucket struct {
+	Min   int    `json:"min" parquet:"min"`
+	Max   int    `json:"max" parquet:"max"`
+	Count uint64 `json:"count" parquet:"count"`
+}
+
+type jsonColumn struct {
+	Column string  `json:"column" parquet:"column"`
+	Min    float64 `json:"min" parquet:"min"`
+	Max    float64 `json:"max" parquet:"max"`
+	Mean   float64 `json:"mean" parquet:"mean"`
+	Sum    float64 `json:"sum" parquet:"sum"`
+}
+
+// writeJSON writes the results as a JSON array with an object per station, in the same order as the results.
+// The sum of squares is written with the standard deviation, so the results can still be merged. Pretty indents
+// the array, which is compact otherwise.
+func writeJSON(w io.Writer, results []*brc.StationResult, aggregations []string, pretty bool) error {
+	stations := make([]jsonStation, 0, len(results))
+	for _, r := range results {
+		stations = append(stations, newJSONStation(r, aggregations))
+	}
+
+	encoder := json.NewEncoder(w)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(stations)
+}
+
+// newJSONStation converts the result of a station to its json object with the fields of the aggregations
+func newJSONStation(r *brc.StationResult, aggregations []string) jsonStation {
+	station := jsonStation{Station: r.Station}
+	for _, a := range aggregations {
+		switch a {
+		case "min":
+			station.Min = &r.Min
+		case "max":
+			station.Max = &r.Max
+		case "mean":
+			station.Mean = &r.Mean
+		case "count":
+			station.Count = &r.Readings
+		case "sum":
+			station.Sum = &r.Sum
+		case "stddev":
+			station.StdDev, station.SumSquares = &r.StdDev, &r.SumSquares
+		}
+	}
+	if len(r.Percentiles) > 0 {
+		station.Percentiles = make(map[string]float64, len(r.Percentiles))
+		for _, p := range r.Percentiles {
+			station.Percentiles[percentileName(p.Quantile)] = p.Value
+		}
+	}
+	// only the buckets with readings are written
+	for i, c := range r.Histogram {
+		if c > 0 {
+			station.Histogram = append(station.Histogram, jsonBucket{brc.HistogramMin + i, brc.HistogramMin + i + 1, c})
+		}
+	}
+	for _, c := range r.Columns {
+		station.Columns = append(station.Columns, jsonColumn{c.Column, c.Min, c.Max, c.Mean, c.Sum})
+	}
+	return station
+}
+
+// writeParquet writes the results as a parquet file with a row per station, in the same order as the results. The
+// statistics are typed columns, the ones that aren't selected are null.
+func writeParquet(w io.Writer, results []*brc.StationResult, aggregations []string) error {
+	schema := parquet.NewSchema("station_stats", parquet.SchemaOf(jsonStation{}))
+	pw := parquet.NewGenericWriter[jsonStation](w, schema)
+	for _, r := range results {
+		_, err := pw.Write([]jsonStation{newJSONStation(r, aggregations)})
+		if err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
+
+// writeCSV writes a header row and a row per station, separated by delimiter. With multiple value columns
+// every column gets its own min, mean and max fields.
+func writeCSV(w io.Writer, results []*brc.StationResult, delimiter rune, format numberFormat, aggregations []string) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = delimiter
+
+	header := append([]string{"station"}, slices.DeleteFunc(slices.Clone(aggregations), func(a string) bool { return a == "histogram" })...)
+	if len(results) > 0 && len(results[0].Columns) > 0 {
+		header = []string{"station"}
+		for _, c := range results[0].Columns {
+			header = append(header, c.Column+"_min", c.Column+"_mean", c.Column+"_max")
+		}
+		header = append(header, "count")
+	}
+	cw.Write(header)
+
+	for _, r := range results {
+		row := []string{r.Station}
+		if len(r.Columns) == 0 {
+			cw.Write(append(row, formatStats(r, aggregations, format)...))
+			continue
+		}
+
+		for _, c := range r.Columns {
+			row = append(row, formatReadings(c.Min, c.Mean, c.Max, format)...)
+		}
+		row = append(row, format.count(r.Readings))
+		cw.Write(row)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// percentileName returns the name of the percentile of quantile q, p99 for 0.99
+func percentileName(q float64) string {
+	return "p" + strconv.FormatFloat(q*100, 'f', -1, 64)
+}
+
+// formatReadings formats the min, mean and max of a value column, the mean always has a decimal
+func formatReadings(min, mean, max float64, format numberFormat) []string {
+	return []string{format.reading(min), format.decimal(mean), format.reading(max)}
+}
+
+type Summary struct {
+	Rows          int     `json:"rows"`
+	Stations      int     `json:"stations"`
+	Min           float64 `json:"min"`
+	Max           float64 `json:"max"`
+	Mean          float64 `json:"mean"`
+	RowsPerSecond float64 `json:"rows_per_second"`
+}
+
+// summarize aggregates the per station results into a single summary of the whole input
+func summarize(results []*brc.StationResult, elapsed time.Duration) Summary {
+	summary := Summary{Stations: len(results)}
+	if len(results) == 0 {
+		return summary
+	}
+
+	summary.Min = results[0].Min
+	summary.Max = results[0].Max
+	total := 0.0
+	for _, r := range results {
+		summary.Min = min(summary.Min, r.Min)
+		summary.Max = max(summary.Max, r.Max)
+		summary.Rows += r.Readings
+		total += r.Sum
+	}
+	summary.Mean = total / float64(summary.Rows)
+
+	if elapsed > 0 {
+		summary.RowsPerSecond = float64(summary.Rows) / elapsed.Seconds()
+	}
+
+	return summary
+}
+
+// writeSummary writes the summary in the format of the flags: a line per statistic, a json object or a header row and
+// a row for csv and tsv. The readings are rounded like those of the stations.
+func writeSummary(w io.Writer, summary Summary, flags CliFlags) error {
+	summary.Min, summary.Max, summary.Mean = brc.Round(summary.Min), brc.Round(summary.Max), brc.Round(summary.Mean)
+	format := numberFormat{intValues: flags.ValueAsInt}
+
+	switch flags.Format {
+	case "json":
+		summary.RowsPerSecond = math.Round(summary.RowsPerSecond)
+		encoder := json.NewEncoder(w)
+		if flags.Pretty {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder.Encode(summary)
+	case "csv", "tsv":
+		format.printer = flags.NumberLocale
+		cw := csv.NewWriter(w)
+		cw.Comma = flags.Delimiter
+		cw.Write([]string{"rows", "stations", "min", "max", "mean", "rows_per_second"})
+		cw.Write([]string{format.count(summary.Rows), format.count(summary.Stations), format.reading(summary.Min), format.reading(summary.Max), format.decimal(summary.Mean), format.float(summary.RowsPerSecond, 0)})
+		cw.Flush()
+		return cw.Error()
+	default:
+		printSummary(w, summary, format)
+		return nil
+	}
+}
+
+func printSummary(w io.Writer, summary Summary, format numberFormat) {
+	fmt.Fprintln(w, "rows:", summary.Rows)
+	fmt.Fprintln(w, "stations:", summary.Stations)
+	fmt.Fprintln(w, "min:", format.reading(summary.Min))
+	fmt.Fprintln(w, "max:", format.reading(summary.Max))
+	fmt.Fprintln(w, "mean:", format.decimal(summary.Mean))
+	fmt.Fprintf(w, "rows/sec: %.0f\n", summary.RowsPerSecond)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	_ "net/http/pprof" // registers the /debug/pprof handlers on http.DefaultServeMux
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiles starts a CPU profile written to cpuProfile, the returned stop function ends it and writes a heap
+// profile to memProfile. Empty paths skip the profile.
+func startProfiles(cpuProfile string, memProfile string) (stop func() error, err error) {
+	var cpuFile *os.File
+	if cpuProfile != "" {
+		cpuFile, err = os.Create(cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("creating cpu profile failed: %w", err)
+		}
+		err = pprof.StartCPUProfile(cpuFile)
+		if err != nil {
+			cpuFile.Close()
+			return nil, fmt.Errorf("starting cpu profile failed: %w", err)
+		}
+	}
+
+	return func() error {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			err := cpuFile.Close()
+			if err != nil {
+				return fmt.Errorf("writing cpu profile failed: %w", err)
+			}
+		}
+
+		if memProfile != "" {
+			memFile, err := os.Create(memProfile)
+			if err != nil {
+				return fmt.Errorf("creating memory profile failed: %w", err)
+			}
+			defer memFile.Close()
+
+			runtime.GC() // get up-to-date statistics
+			err = pprof.WriteHeapProfile(memFile)
+			if err != nil {
+				return fmt.Errorf("writing memory profile failed: %w", err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// startPprofServer serves the net/http/pprof endpoints on addr until the returned stop function is called, so long
+// runs can be profiled live
+func startPprofServer(addr string) (stop func(), err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("starting pprof server failed: %w", err)
+	}
+	log.Printf("serving pprof on http://%s/debug/pprof/", listener.Addr())
+
+	server := &http.Server{Handler: http.DefaultServeMux}
+	go func() {
+		err := server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Println("pprof server failed:", err)
+		}
+	}()
+
+	return func() { server.Close() }, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// progressRecord is the progress at a point in time, a line of the -progress-json output. The total, percentage and
+// ETA are 0 when the size of the input is unknown.
+type progressRecord struct {
+	BytesRead  int64   `json:"bytesRead"`
+	TotalBytes int64   `json:"totalBytes"`
+	Percent    float64 `json:"percent"`
+	Rows       int64   `json:"rows"`
+	RowsPerSec float64 `json:"rowsPerSec"`
+	ETASeconds float64 `json:"etaSeconds"`
+}
+
+// newProgressRecord returns the progress of bytes and rows read after elapsed, of an input of total bytes
+func newProgressRecord(bytes int64, rows int64, total int64, elapsed time.Duration) progressRecord {
+	record := progressRecord{BytesRead: bytes, Rows: rows, RowsPerSec: float64(rows) / elapsed.Seconds()}
+	if total > 0 && bytes > 0 {
+		record.TotalBytes = total
+		record.Percent = 100 * float64(bytes) / float64(total)
+		record.ETASeconds = elapsed.Seconds() * float64(max(total-bytes, 0)) / float64(bytes)
+	}
+	return record
+}
+
+// reportProgress passes the progress to every report function every interval until the returned stop function is
+// called. total is the size of the input in bytes, 0 when it is unknown.
+func reportProgress(progress *brc.Progress, total int64, interval time.Duration, reports ...func(progressRecord)) (stop func()) {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			record := newProgressRecord(progress.Bytes(), progress.Rows(), total, time.Since(start))
+			for _, report := range reports {
+				report(record)
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
+
+// startProgress reports the progress every second with -progress and -progress-json until the returned stop
+// function is called. total is the size of the input in bytes, 0 when it is unknown.
+func startProgress(progress *brc.Progress, total int64, flags CliFlags) (stop func(), err error) {
+	var reports []func(progressRecord)
+	if flags.Progress {
+		reports = append(reports, logProgress)
+	}
+
+	var file *os.File
+	if flags.ProgressJSON == "-" {
+		reports = append(reports, jsonProgress(os.Stderr))
+	} else if flags.ProgressJSON != "" {
+		// not replaced atomically like the other outputs, it may be a named pipe read while processing
+		file, err = os.OpenFile(flags.ProgressJSON, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening -progress-json failed: %w", err)
+		}
+		reports = append(reports, jsonProgress(file))
+	}
+
+	stopReports := reportProgress(progress, total, time.Second, reports...)
+	return func() {
+		stopReports()
+		if file != nil {
+			file.Close()
+		}
+	}, nil
+}
+
+// logProgress logs the progress for -progress, with the percentage and ETA when the size of the input is known
+func logProgress(record progressRecord) {
+	rate := fmt.Sprintf("%.1fM rows/s", record.RowsPerSec/1e6)
+	if record.TotalBytes == 0 {
+		log.Printf("progress: %s, %s", formatBytes(record.BytesRead), rate)
+		return
+	}
+
+	remaining := time.Duration(record.ETASeconds * float64(time.Second))
+	log.Printf("progress: %s of %s (%.1f%%), %s, ETA %s", formatBytes(record.BytesRead), formatBytes(record.TotalBytes),
+		record.Percent, rate, remaining.Round(time.Second))
+}
+
+// jsonProgress returns the report function of -progress-json, which writes every record as a line of json to w
+func jsonProgress(w io.Writer) func(progressRecord) {
+	encoder := json.NewEncoder(w)
+	return func(record progressRecord) {
+		encoder.Encode(record)
+	}
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+}
+
+// reportThroughput logs the rows and bytes per second of the run, and the rows per second of every chunk when the
+// chunks were read by parallel workers. bytes is left out of the report when it is unknown (0).
+func reportThroughput(timings *brc.Timings, bytes int64, elapsed time.Duration) {
+	rows := timings.Rows()
+	rate := fmt.Sprintf("%.1fM rows/s", float64(rows)/elapsed.Seconds()/1e6)
+	if bytes > 0 {
+		rate += fmt.Sprintf(", %.1f MiB/s", float64(bytes)/(1<<20)/elapsed.Seconds())
+	}
+	log.Printf("throughput: %d rows in %s, %s", rows, elapsed.Round(time.Millisecond), rate)
+
+	chunks := timings.Chunks()
+	if len(chunks) < 2 {
+		return
+	}
+	for i, c := range chunks {
+		log.Printf("throughput of worker %d: %d rows in %s, %.1fM rows/s", i, c.Rows, c.Time.Round(time.Millisecond),
+			float64(c.Rows)/c.Time.Seconds()/1e6)
+	}
+}
+
+// reportMapStats logs the health of the station tables
+func reportMapStats(stats *brc.MapStats) {
+	log.Printf("station tables: %d tables with %d stations, load factor %.2f, %d resizes, longest probe %d, %d collisions",
+		stats.Tables, stats.Stations, stats.LoadFactor, stats.Resizes, stats.MaxProbe, stats.Collisions)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+func TestNewProgressRecord(t *testing.T) {
+	record := newProgressRecord(250, 20, 1000, 2*time.Second)
+	want := progressRecord{BytesRead: 250, TotalBytes: 1000, Percent: 25, Rows: 20, RowsPerSec: 10, ETASeconds: 6}
+	if record != want {
+		t.Errorf("expected %+v, got %+v", want, record)
+	}
+
+	// without the size of the input there is no percentage or ETA
+	record = newProgressRecord(250, 20, 0, 2*time.Second)
+	want = progressRecord{BytesRead: 250, Rows: 20, RowsPerSec: 10}
+	if record != want {
+		t.Errorf("expected %+v, got %+v", want, record)
+	}
+}
+
+func TestProgressJSON(t *testing.T) {
+	input := "Abha;1.0\nBerlin;-2.5\nCairo;30.0\n"
+	progress := &brc.Progress{}
+	_, err := brc.ProcessInputs([]io.Reader{strings.NewReader(input)}, brc.Options{Progress: progress})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the records are encoded on the reporting goroutine, the channel hands them over once written
+	lines := make(chan []byte, 16)
+	var buf bytes.Buffer
+	report := jsonProgress(&buf)
+	stop := reportProgress(progress, int64(len(input)), time.Millisecond, func(record progressRecord) {
+		report(record)
+		lines <- bytes.Clone(buf.Bytes())
+		buf.Reset()
+	})
+	first, second := <-lines, <-lines
+	stop()
+
+	for _, line := range [][]byte{first, second} {
+		var record map[string]float64
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("expected a line of json, got %q: %v", line, err)
+		}
+		if record["bytesRead"] != float64(len(input)) || record["totalBytes"] != float64(len(input)) || record["percent"] != 100 || record["rows"] != 3 || record["etaSeconds"] != 0 {
+			t.Errorf("expected all %d bytes and 3 rows read, got %s", len(input), line)
+		}
+		if record["rowsPerSec"] <= 0 {
+			t.Errorf("expected the rows per second, got %s", line)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// remoteRetryDelay is the wait before the first retry of a remote input, it doubles with every consecutive failure
+const remoteRetryDelay = 500 * time.Millisecond
+
+// isRemote reports whether path is an http(s) or s3 URL rather than a local file
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "s3://")
+}
+
+// openRemote streams the object at the http(s) or s3 URL rawURL, reading it is retried up to retries times after
+// consecutive failures. It also returns the path of the URL to detect the compression by. S3 uses the credentials and
+// region of the AWS environment, like the aws cli.
+func openRemote(ctx context.Context, rawURL string, retries int) (io.ReadCloser, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing URL failed: %w", err)
+	}
+
+	r := &remoteReader{ctx: ctx, maxRetries: retries, delay: remoteRetryDelay}
+	switch u.Scheme {
+	case "s3":
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("loading AWS config failed: %w", err)
+		}
+		r.open = s3Opener(s3.NewFromConfig(cfg), u.Host, strings.TrimPrefix(u.Path, "/"))
+	default:
+		r.open = httpOpener(u.String())
+	}
+
+	// open right away, so a missing object fails before processing starts
+	r.body, err = r.open(ctx, 0, "")
+	if err != nil {
+		return nil, "", fmt.Errorf("opening %s failed: %w", rawURL, err)
+	}
+	return r, path.Base(u.Path), nil
+}
+
+// remoteOpener requests an object from offset on. When etag isn't empty the request fails if the object changed.
+type remoteOpener func(ctx context.Context, offset int64, etag string) (remoteBody, error)
+
+type remoteBody struct {
+	io.ReadCloser
+	etag string
+	// why the rest of the object can't be requested from an offset, empty when it can
+	notResumable string
+}
+
+// remoteReader streams a remote object. When reading fails midway it requests the rest of the object from the
+// offset it got to, so a dropped connection doesn't restart a long run. The rest has to be of the same version of
+// the object, so the source has to support range requests and ETags.
+type remoteReader struct {
+	ctx        context.Context
+	open       remoteOpener
+	body       remoteBody
+	offset     int64
+	maxRetries int
+	delay      time.Duration // wait before the first retry
+	retries    int           // consecutive failed attempts
+}
+
+func (r *remoteReader) Read(p []byte) (int, error) {
+	for {
+		if r.body.ReadCloser == nil {
+			body, err := r.open(r.ctx, r.offset, r.body.etag)
+			if err != nil {
+				if !r.retry(err) {
+					return 0, err
+				}
+				continue
+			}
+			r.body = body
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.retries = 0
+		}
+		if err == nil || errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		r.body.Close()
+		r.body.ReadCloser = nil
+		if r.body.notResumable != "" && r.maxRetries > 0 {
+			return n, fmt.Errorf("%w, and reading can't be retried from byte %d because %s", err, r.offset, r.body.notResumable)
+		}
+		if n > 0 {
+			return n, nil // the rest is requested on the next read
+		}
+		if !r.retry(err) {
+			return 0, err
+		}
+	}
+}
+
+// retry waits before the next attempt, it returns false when err isn't worth retrying or the retries are used up
+func (r *remoteReader) retry(err error) bool {
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) && status.HTTPStatusCode() < 500 && status.HTTPStatusCode() != http.StatusTooManyRequests {
+		return false
+	}
+	if r.retries >= r.maxRetries || r.ctx.Err() != nil {
+		return false
+	}
+
+	delay := r.delay << r.retries
+	r.retries++
+	log.Println("reading remote input failed, retrying from byte", r.offset, "in", delay, "-", err)
+	select {
+	case <-time.After(delay):
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+func (r *remoteReader) Close() error {
+	if r.body.ReadCloser == nil {
+		return nil
+	}
+	return r.body.Close()
+}
+
+// statusError is a response with an unexpected status code
+type statusError struct {
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return "unexpected response " + e.status
+}
+
+func (e *statusError) HTTPStatusCode() int {
+	return e.code
+}
+
+func httpOpener(u string) remoteOpener {
+	return func(ctx context.Context, offset int64, etag string) (remoteBody, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return remoteBody{}, err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		if etag != "" {
+			req.Header.Set("If-Match", etag)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return remoteBody{}, err
+		}
+		want := http.StatusOK
+		if offset > 0 {
+			// a server that ignores the range would send the object from the start again
+			want = http.StatusPartialContent
+		}
+		if resp.StatusCode != want {
+			resp.Body.Close()
+			return remoteBody{}, &statusError{resp.Status, resp.StatusCode}
+		}
+
+		body := remoteBody{ReadCloser: resp.Body, etag: resp.Header.Get("ETag")}
+		switch {
+		case resp.Header.Get("Accept-Ranges") != "bytes":
+			body.notResumable = "the server doesn't support range requests"
+		case body.etag == "":
+			body.notResumable = "the server sends no ETag to check the object didn't change"
+		}
+		return body, nil
+	}
+}
+
+func s3Opener(client *s3.Client, bucket string, key string) remoteOpener {
+	return func(ctx context.Context, offset int64, etag string) (remoteBody, error) {
+		input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+		if offset > 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+		}
+		if etag != "" {
+			input.IfMatch = aws.String(etag)
+		}
+
+		out, err := client.GetObject(ctx, input)
+		if err != nil {
+			return remoteBody{}, err
+		}
+		return remoteBody{ReadCloser: out.Body, etag: aws.ToString(out.ETag)}, nil
+	}
+}
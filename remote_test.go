@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyBody fails with err once it returned n bytes of data
+type flakyBody struct {
+	data []byte
+	n    int
+	err  error
+}
+
+func (b *flakyBody) Read(p []byte) (int, error) {
+	if b.n == 0 {
+		return 0, b.err
+	}
+	n := copy(p, b.data[:min(b.n, len(b.data))])
+	b.data, b.n = b.data[n:], b.n-n
+	if len(b.data) == 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (b *flakyBody) Close() error {
+	return nil
+}
+
+func TestRemoteReaderRetry(t *testing.T) {
+	data := []byte("Abha;1.0\nBerlin;-2.5\nCairo;30.0\n")
+	var offsets []int64
+	// the first request drops the connection after 10 bytes, the rest is read in one go
+	open := func(_ context.Context, offset int64, etag string) (remoteBody, error) {
+		offsets = append(offsets, offset)
+		if len(offsets) > 1 && etag != "v1" {
+			return remoteBody{}, fmt.Errorf("expected the etag of the first response, got %q", etag)
+		}
+		body := &flakyBody{data: data[offset:], n: len(data), err: errors.New("connection reset")}
+		if offset == 0 {
+			body.n = 10
+		}
+		return remoteBody{ReadCloser: body, etag: "v1"}, nil
+	}
+
+	r := &remoteReader{ctx: context.Background(), open: open, maxRetries: 1, delay: time.Millisecond}
+	var err error
+	r.body, err = open(r.ctx, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("expected %q, got %q", data, got)
+	}
+	if want := []int64{0, 10}; !slices.Equal(offsets, want) {
+		t.Errorf("expected requests from %v, got %v", want, offsets)
+	}
+
+	// without retries the error is returned right away
+	offsets = nil
+	r = &remoteReader{ctx: context.Background(), open: open, delay: time.Millisecond}
+	r.body, _ = open(r.ctx, 0, "")
+	_, err = io.ReadAll(r)
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("expected the read error without -retry, got %v", err)
+	}
+}
+
+// flakyServer serves data, dropping the connection after half of it on the first request. Without ranges it doesn't
+// support range requests.
+func flakyServer(t *testing.T, data []byte, ranges bool) *httptest.Server {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ranges {
+			w.Header().Set("ETag", `"v1"`)
+		}
+		if requests.Add(1) > 1 && ranges {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			return
+		}
+
+		if ranges {
+			w.Header().Set("Accept-Ranges", "bytes")
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRemoteRetry(t *testing.T) {
+	input := "Abha;1.0\nBerlin;-2.5\nCairo;30.0\nAbha;3.0\n"
+	want := processOutput(t, input)
+
+	server := flakyServer(t, []byte(input), true)
+	got, err := goldenOutput(server.URL+"/measurements.txt", []string{"-retry", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	server = flakyServer(t, []byte(input), true)
+	_, err = goldenOutput(server.URL+"/measurements.txt", []string{"-retry", "0"})
+	if err == nil {
+		t.Error("expected the dropped connection to fail with -retry 0")
+	}
+}
+
+func TestRemoteRetryNotResumable(t *testing.T) {
+	input := "Abha;1.0\nBerlin;-2.5\nCairo;30.0\nAbha;3.0\n"
+	server := flakyServer(t, []byte(input), false)
+	_, err := goldenOutput(server.URL+"/measurements.txt", []string{"-retry", "3"})
+	want := fmt.Sprintf("can't be retried from byte %d because the server doesn't support range requests", len(input)/2)
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected an error that reading can't be retried, got %v", err)
+	}
+}
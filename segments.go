@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// segmentSize is the size of the parts of the file processed one after the other by processSegments, checkpoints
+// and snapshots are only written once a whole segment is aggregated. It is a variable for tests.
+var segmentSize int64 = 256 * 1024 * 1024
+
+// checkpoint is the state of a run written with -checkpoint, the results of the Lines lines before Offset of the
+// file. The size and modification time tell whether the file is still the one the checkpoint was written for.
+type checkpoint struct {
+	File    string
+	Size    int64
+	ModTime time.Time
+	Offset  int64
+	Lines   int64
+	Results brc.Results
+}
+
+// processSegments processes the file segment by segment, so the results so far are known while processing. With
+// -checkpoint they are written to the checkpoint file with the offset they reach every interval, with -resume it
+// continues from the checkpoint instead of the start of the file. When interrupted the checkpoint is written once
+// more, it is removed once the results are written. With -snapshot-every the results so far are written like the
+// final results every interval.
+func processSegments(ctx context.Context, path string, flags CliFlags) error {
+	log.Println("starting to process", path, "in segments")
+	start := time.Now()
+
+	opts, closeBadLines, err := processOptions(flags)
+	if err != nil {
+		return err
+	}
+	defer closeBadLines()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening file for reading failed: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("-checkpoint and -snapshot-every only apply to regular files")
+	}
+	magic := make([]byte, len(zstdMagic))
+	n, _ := file.ReadAt(magic, 0)
+	if flags.Compression != "none" && detectCompression(file.Name(), magic[:n]) != "none" || isParquet(file) {
+		return errors.New("-checkpoint and -snapshot-every can't split compressed or parquet files")
+	}
+
+	if flags.AutoSize {
+		err = autoSize(&opts, file, flags, start)
+		if err != nil {
+			return err
+		}
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	state := checkpoint{File: abs, Size: info.Size(), ModTime: info.ModTime()}
+	if flags.Resume {
+		saved, err := readCheckpoint(flags.Checkpoint)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			log.Println("no checkpoint to resume from, starting from the beginning")
+		case err != nil:
+			return err
+		case saved.File != state.File || saved.Size != state.Size || !saved.ModTime.Equal(state.ModTime):
+			return fmt.Errorf("the checkpoint in %s was written for another version of %s", flags.Checkpoint, saved.File)
+		default:
+			state = saved
+			log.Println("resuming from byte", state.Offset, "with", len(state.Results.Stations), "stations")
+		}
+	}
+
+	// the lines of the segments are counted so the line number of a malformed line is that within the file
+	opts.Progress = &brc.Progress{}
+	if flags.Progress || flags.ProgressJSON != "" {
+		stop, err := startProgress(opts.Progress, state.Size-state.Offset, flags)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	saved, snapshot := time.Now(), time.Now()
+	for state.Offset < state.Size {
+		opts.Offset, opts.Length = state.Offset, min(segmentSize, state.Size-state.Offset)
+		rows := opts.Progress.Rows()
+		part, err := brc.ProcessInputsContext(ctx, []io.Reader{file}, opts)
+		if err != nil && ctx.Err() != nil && flags.Checkpoint != "" {
+			// the segment is only partly aggregated, the checkpoint stays at its start
+			err = writeCheckpoint(flags.Checkpoint, state)
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("interrupted at byte %d, continue with -resume", state.Offset)
+		}
+		if err != nil && ctx.Err() != nil {
+			return errors.New("interrupted before all measurements were read")
+		}
+		if err != nil {
+			return offsetLineError(err, state.Lines)
+		}
+		state.Results.Merge(part)
+		state.Offset += opts.Length
+		state.Lines += opts.Progress.Rows() - rows
+
+		if flags.Checkpoint != "" && time.Since(saved) >= flags.CheckpointDur && state.Offset < state.Size {
+			err = writeCheckpoint(flags.Checkpoint, state)
+			if err != nil {
+				return err
+			}
+			log.Println("wrote checkpoint at byte", state.Offset, time.Since(start))
+			saved = time.Now()
+		}
+		if flags.SnapshotEvery > 0 && time.Since(snapshot) >= flags.SnapshotEvery && state.Offset < state.Size {
+			err = writeSnapshot(state.Results, flags, start)
+			if err != nil {
+				return err
+			}
+			log.Println("wrote snapshot at byte", state.Offset, time.Since(start))
+			snapshot = time.Now()
+		}
+	}
+
+	results := state.Results
+	log.Println("calculated min/max/mean", time.Since(start))
+	if results.Skipped > 0 {
+		log.Println("skipped", results.Skipped, "malformed lines")
+	}
+	if results.Excluded > 0 {
+		log.Println("excluded", results.Excluded, "readings outside of -min-temp and -max-temp")
+	}
+
+	if flags.Checksum {
+		err = logChecksum(results, flags.ValueAsInt)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeOutputFile(orderResults(results, flags, start), flags, time.Since(start))
+	if err != nil {
+		return err
+	}
+	log.Println("wrote results", time.Since(start))
+	if opts.MapStats != nil {
+		reportMapStats(opts.MapStats)
+	}
+
+	if flags.Checkpoint == "" {
+		return nil
+	}
+	err = os.Remove(flags.Checkpoint)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing checkpoint failed: %w", err)
+	}
+	return nil
+}
+
+// offsetLineError adds lines to the line number of a *brc.LineError, for input read from after its first line
+func offsetLineError(err error, lines int64) error {
+	var lineErr *brc.LineError
+	if errors.As(err, &lineErr) {
+		lineErr.Line += int(lines)
+	}
+	return err
+}
+
+func readCheckpoint(path string) (checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return checkpoint{}, err
+	}
+	defer file.Close()
+
+	var state checkpoint
+	err = gob.NewDecoder(file).Decode(&state)
+	if err != nil {
+		return checkpoint{}, fmt.Errorf("reading checkpoint %s failed: %w", path, err)
+	}
+	return state, nil
+}
+
+// writeCheckpoint replaces the checkpoint file, an interrupted write leaves the previous checkpoint in place
+func writeCheckpoint(path string, state checkpoint) error {
+	err := writeAtomic(path, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(state)
+	})
+	if err != nil {
+		return fmt.Errorf("writing checkpoint failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+const (
+	selfTestRows = 100_000
+	selfTestSeed = 1
+	// sha256 of the output of the self-test dataset in the default format
+	selfTestOutput = "6d7b7a4919ef1bda344de46d102aa06d4e7417fde4a20bcbce1309cf2f8661e6"
+)
+
+// runSelfTest generates a small dataset with a fixed seed in memory and processes it like the process subcommand
+// would, in every read mode, parser and merge strategy. Every output has to match the known output of the dataset.
+// A mismatch is compared with the reference implementation of validate to report the stations that differ.
+func runSelfTest() error {
+	start := time.Now()
+	var data bytes.Buffer
+	err := generateMeasurements(&data, rand.New(rand.NewPCG(selfTestSeed, selfTestSeed)), selfTestRows)
+	if err != nil {
+		return err
+	}
+
+	// regular files are split into chunks, the other modes need the dataset on disk
+	file, err := os.CreateTemp("", "brc-selftest-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	_, err = file.Write(data.Bytes())
+	if err != nil {
+		return fmt.Errorf("writing the self-test dataset failed: %w", err)
+	}
+
+	modes := []struct {
+		name string
+		file bool
+		opts brc.Options
+	}{
+		{"in memory", false, brc.Options{}},
+		{"4 chunks", true, brc.Options{Workers: 4}},
+		{"4 memory mapped chunks", true, brc.Options{Workers: 4, Mmap: true}},
+		{"4 sharded chunks", true, brc.Options{Workers: 4, MergeStrategy: brc.MergeSharded}},
+		{"float parser", true, brc.Options{Workers: 4, Parser: brc.ParseFloat}},
+		{"spilled stations", true, brc.Options{Workers: 4, SpillStations: 50}},
+	}
+
+	failed := 0
+	for _, mode := range modes {
+		var input io.Reader = bytes.NewReader(data.Bytes())
+		if mode.file {
+			_, err = file.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			input = file
+		}
+		results, err := brc.ProcessInputs([]io.Reader{input}, mode.opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", mode.name, err)
+		}
+
+		results.Sort()
+		var output bytes.Buffer
+		err = writeResults(&output, results.Rounded().Stations, false, defaultAggregations("brc"))
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(output.Bytes())
+		if hex.EncodeToString(sum[:]) == selfTestOutput {
+			fmt.Println("ok  ", mode.name)
+			continue
+		}
+
+		fmt.Println("FAIL", mode.name)
+		failed++
+		expected, err := referenceResults(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			return err
+		}
+		compareResults(os.Stdout, expected, results.Rounded().Stations)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d self-test modes failed", failed, len(modes))
+	}
+	log.Println("self-test of", selfTestRows, "rows passed in", time.Since(start))
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+type ServeFlags struct {
+	File    string
+	Addr    string
+	IO      string
+	Parser  string
+	Workers int
+}
+
+func parseServeFlags(args []string) (ServeFlags, error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	file := fs.String("file", "", "specify the file to process")
+	addr := fs.String("addr", ":8080", "address to serve the results on")
+	ioMode := fs.String("io", "scanner", "how the file is read: scanner or mmap")
+	parser := fs.String("parser", "fixed", "how readings are parsed: fixed or float")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of chunks the file is split into and read in parallel")
+	err := fs.Parse(args)
+	if err != nil {
+		return ServeFlags{}, err
+	}
+
+	if *file == "" {
+		return ServeFlags{}, errors.New("no file specified")
+	}
+	if *ioMode != "scanner" && *ioMode != "mmap" {
+		return ServeFlags{}, fmt.Errorf("unknown io %q", *ioMode)
+	}
+	if *parser != "fixed" && *parser != "float" {
+		return ServeFlags{}, fmt.Errorf("unknown parser %q", *parser)
+	}
+	if *workers < 1 {
+		return ServeFlags{}, errors.New("-workers must be at least 1")
+	}
+
+	return ServeFlags{*file, *addr, *ioMode, *parser, *workers}, nil
+}
+
+// runServe processes the file once and then serves the results as json until SIGINT or SIGTERM, /stations lists all
+// stations sorted by name and /stations/{name} a single station
+func runServe(args []string) error {
+	flags, err := parseServeFlags(args)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	opts := brc.Options{Mmap: flags.IO == "mmap", Workers: flags.Workers}
+	if flags.Parser == "float" {
+		opts.Parser = brc.ParseFloat
+	}
+
+	file, err := os.Open(flags.File)
+	if err != nil {
+		return fmt.Errorf("opening file for reading failed: %w", err)
+	}
+	defer file.Close()
+	input, err := decompress(file, "auto")
+	if err != nil {
+		return err
+	}
+	if c, ok := input.(io.Closer); ok && input != io.Reader(file) {
+		defer c.Close()
+	}
+
+	results, err := brc.ProcessInputs([]io.Reader{input}, opts)
+	if err != nil {
+		return err
+	}
+	results = results.Rounded()
+	results.Sort()
+	log.Println("processed", len(results.Stations), "stations", time.Since(start))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", flags.Addr)
+	if err != nil {
+		return fmt.Errorf("starting server failed: %w", err)
+	}
+	log.Printf("serving results on http://%s/stations", listener.Addr())
+
+	server := &http.Server{Handler: resultsHandler(results, defaultAggregations("json"))}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	err = server.Serve(listener)
+	if !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving results failed: %w", err)
+	}
+	return nil
+}
+
+// resultsHandler serves the results, which are sorted by name, as json
+func resultsHandler(results brc.Results, aggregations []string) http.Handler {
+	stations := make([]jsonStation, 0, len(results.Stations))
+	byName := make(map[string]jsonStation, len(results.Stations))
+	for _, r := range results.Stations {
+		station := newJSONStation(r, aggregations)
+		stations = append(stations, station)
+		byName[r.Station] = station
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stations", func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, http.StatusOK, stations)
+	})
+	mux.HandleFunc("GET /stations/{name}", func(w http.ResponseWriter, r *http.Request) {
+		station, ok := byName[r.PathValue("name")]
+		if !ok {
+			writeJSONResponse(w, http.StatusNotFound, map[string]string{"error": "unknown station"})
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, station)
+	})
+	return mux
+}
+
+func writeJSONResponse(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println("writing response failed:", err)
+	}
+}
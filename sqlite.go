@@ -0,0 +1,80 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite" // registers the sqlite database/sql driver
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// writeSQLite writes the results to a new sqlite database at path, with a station_stats table that has a row per
+// station and a typed column per aggregation. With multiple value columns every column gets its own min, mean and
+// max columns. Like writeAtomic the database is written next to path and only replaces it once it is complete.
+func writeSQLite(path string, results []*brc.StationResult, aggregations []string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// sqlite opens the empty file as a new database
+	file.Close()
+	defer os.Remove(file.Name()) // fails once renamed
+
+	err = fillSQLite(file.Name(), results, aggregations)
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func fillSQLite(path string, results []*brc.StationResult, aggregations []string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	columns := []string{`"station" TEXT PRIMARY KEY`}
+	for _, c := range statColumns(results, aggregations) {
+		typ := "REAL"
+		if c.integer {
+			typ = "INTEGER"
+		}
+		columns = append(columns, `"`+strings.ReplaceAll(c.name, `"`, `""`)+`" `+typ)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op once committed
+
+	_, err = tx.Exec("CREATE TABLE station_stats (" + strings.Join(columns, ", ") + ")")
+	if err != nil {
+		return fmt.Errorf("creating table failed: %w", err)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	insert, err := tx.Prepare("INSERT INTO station_stats VALUES (" + placeholders + ")")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for _, r := range results {
+		_, err = insert.Exec(append([]any{r.Station}, statValues(r, aggregations)...)...)
+		if err != nil {
+			return fmt.Errorf("inserting %s failed: %w", r.Station, err)
+		}
+	}
+
+	return tx.Commit()
+}
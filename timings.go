@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// phaseTimings are the durations of the phases of processing, measured by processFiles
+type phaseTimings struct {
+	start     time.Time
+	processed time.Time
+	sorted    time.Time
+	written   time.Time
+}
+
+// jsonTimings is the -timings json summary, the durations are in seconds. Reading and parsing happen together in
+// aggregate, read is the time spent waiting for reads summed over the chunks read in parallel.
+type jsonTimings struct {
+	Read      float64 `json:"read"`
+	Aggregate float64 `json:"aggregate"`
+	Merge     float64 `json:"merge"`
+	Sort      float64 `json:"sort"`
+	Write     float64 `json:"write"`
+	Total     float64 `json:"total"`
+	Rows      int     `json:"rows"`
+	Bytes     int64   `json:"bytes"`
+	Skipped   int     `json:"skipped"`
+}
+
+// writeTimings writes the timings as json to path, or to stderr when path is empty
+func writeTimings(path string, phases phaseTimings, timings *brc.Timings, progress *brc.Progress, skipped int) error {
+	summary := jsonTimings{
+		Read:      timings.Read().Seconds(),
+		Aggregate: timings.Aggregate().Seconds(),
+		Merge:     timings.Merge().Seconds(),
+		Sort:      phases.sorted.Sub(phases.processed).Seconds(),
+		Write:     phases.written.Sub(phases.sorted).Seconds(),
+		Total:     phases.written.Sub(phases.start).Seconds(),
+		Rows:      timings.Rows(),
+		Bytes:     progress.Bytes(),
+		Skipped:   skipped,
+	}
+
+	write := func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(summary)
+	}
+	if path == "" {
+		return write(os.Stderr)
+	}
+	err := writeAtomic(path, write)
+	if err != nil {
+		return fmt.Errorf("writing timings failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+type ValidateFlags struct {
+	File   string
+	Expect string // expected output the fast path is compared with instead of the reference implementation
+	IO     string
+	Parser string
+	Golden string // directory of measurement files with their expected outputs
+	Update bool
+	Fuzz   int // number of generated readings to compare the parsers with strconv on
+}
+
+func parseValidateFlags(args []string) (ValidateFlags, error) {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	file := fs.String("file", "", "specify the file to validate")
+	ioMode := fs.String("io", "scanner", "how the fast path reads the file: scanner or mmap")
+	parser := fs.String("parser", "fixed", "how the fast path parses readings: fixed or float")
+	golden := fs.String("golden", "", "directory of measurement files name.txt with their expected output name.out, and optionally extra flags in name.flags. Every file is processed like the process subcommand and its output compared byte for byte")
+	update := fs.Bool("update", false, "write the outputs of the -golden files instead of comparing them")
+	expected := fs.String("expected", "", "compare the output of the fast path with the expected output in this file, like the output of the Java baseline, instead of the reference implementation")
+	fuzz := fs.Int("fuzz", 0, "compare every parser with strconv.ParseFloat on this many generated readings, corner cases like -, . and overlong mantissas included")
+	err := fs.Parse(args)
+	if err != nil {
+		return ValidateFlags{}, err
+	}
+
+	if *update && *golden == "" {
+		return ValidateFlags{}, errors.New("-update requires -golden")
+	}
+	if *fuzz < 0 {
+		return ValidateFlags{}, errors.New("-fuzz can't be negative")
+	}
+	if *file == "" && *golden == "" && *fuzz == 0 {
+		return ValidateFlags{}, errors.New("no file specified")
+	}
+	if *expected != "" && *file == "" {
+		return ValidateFlags{}, errors.New("-expected requires -file")
+	}
+	if *ioMode != "scanner" && *ioMode != "mmap" {
+		return ValidateFlags{}, fmt.Errorf("unknown io %q", *ioMode)
+	}
+	if *parser != "fixed" && *parser != "float" {
+		return ValidateFlags{}, fmt.Errorf("unknown parser %q", *parser)
+	}
+
+	return ValidateFlags{*file, *expected, *ioMode, *parser, *golden, *update, *fuzz}, nil
+}
+
+// runValidate processes the file with both the fast path and a slow but obviously correct reference implementation,
+// and reports every station whose rounded min, mean or max differ between the two
+func runValidate(args []string) error {
+	flags, err := parseValidateFlags(args)
+	if err != nil {
+		return err
+	}
+	if flags.Golden != "" {
+		return runGolden(flags.Golden, flags.Update)
+	}
+	if flags.Fuzz > 0 {
+		return fuzzParsers(flags.Fuzz)
+	}
+
+	file, err := os.Open(flags.File)
+	if err != nil {
+		return fmt.Errorf("opening file for reading failed: %w", err)
+	}
+	defer file.Close()
+
+	opts := brc.Options{Mmap: flags.IO == "mmap"}
+	if flags.Parser == "float" {
+		opts.Parser = brc.ParseFloat
+	}
+	results, err := brc.ProcessInputs([]io.Reader{file}, opts)
+	if err != nil {
+		return err
+	}
+	log.Println("processed the file with the fast path")
+
+	if flags.Expect != "" {
+		err = checkExpected(os.Stdout, results, false, flags.Expect)
+		if err != nil {
+			return err
+		}
+		fmt.Println("all", len(results.Stations), "stations match", flags.Expect)
+		return nil
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	expected, err := referenceResults(file)
+	if err != nil {
+		return err
+	}
+	log.Println("processed the file with the reference implementation")
+
+	mismatches := compareResults(os.Stdout, expected, results.Rounded().Stations)
+	if mismatches > 0 {
+		return fmt.Errorf("%d of %d stations differ from the reference implementation", mismatches, len(expected))
+	}
+
+	fmt.Println("all", len(expected), "stations match the reference implementation")
+	return nil
+}
+
+// referenceResults aggregates r the straightforward way, with strconv.ParseFloat and a plain map, returning rounded results.
+// The sums are kept as exact rationals so summing a lot of floats can't make the mean drift.
+func referenceResults(r io.Reader) (map[string]brc.StationResult, error) {
+	type aggregate struct {
+		min, max float64
+		sum      *big.Rat
+		count    int
+	}
+
+	stations := map[string]*aggregate{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		station, value, ok := strings.Cut(scanner.Text(), ";")
+		if !ok {
+			continue
+		}
+
+		reading, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("reference implementation failed to parse %q: %w", value, err)
+		}
+
+		exact, ok := new(big.Rat).SetString(value)
+		if !ok {
+			return nil, fmt.Errorf("reference implementation failed to parse %q", value)
+		}
+
+		a, ok := stations[station]
+		if !ok {
+			stations[station] = &aggregate{reading, reading, exact, 1}
+			continue
+		}
+		a.min = math.Min(a.min, reading)
+		a.max = math.Max(a.max, reading)
+		a.sum.Add(a.sum, exact)
+		a.count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]brc.StationResult, len(stations))
+	for station, a := range stations {
+		mean, _ := new(big.Rat).Quo(a.sum, big.NewRat(int64(a.count), 1)).Float64()
+		results[station] = brc.StationResult{
+			Station:  station,
+			Min:      brc.Round(a.min),
+			Max:      brc.Round(a.max),
+			Mean:     brc.Round(mean),
+			Readings: a.count,
+		}
+	}
+
+	return results, nil
+}
+
+// compareResults writes a line to w for every station that is missing or differs, and returns the number of such stations
+func compareResults(w io.Writer, expected map[string]brc.StationResult, actual []*brc.StationResult) int {
+	mismatches := 0
+	seen := make(map[string]bool, len(actual))
+	for _, a := range actual {
+		seen[a.Station] = true
+		e, ok := expected[a.Station]
+		if !ok {
+			fmt.Fprintf(w, "%s: not in the reference results\n", a.Station)
+			mismatches++
+			continue
+		}
+
+		if e.Min != a.Min || e.Mean != a.Mean || e.Max != a.Max || e.Readings != a.Readings {
+			fmt.Fprintf(w, "%s: expected %.1f/%.1f/%.1f (%d readings), got %.1f/%.1f/%.1f (%d readings)\n",
+				a.Station, e.Min, e.Mean, e.Max, e.Readings, a.Min, a.Mean, a.Max, a.Readings)
+			mismatches++
+		}
+	}
+
+	missing := []string{}
+	for station := range expected {
+		if !seen[station] {
+			missing = append(missing, station)
+		}
+	}
+	slices.Sort(missing)
+	for _, station := range missing {
+		fmt.Fprintf(w, "%s: missing from the results\n", station)
+		mismatches++
+	}
+
+	return mismatches
+}
+
+// goldenVariants are the ways every golden file is processed, the output has to be the same for all of them
+var goldenVariants = [][]string{
+	{"-workers", "1"},
+	{"-workers", "7"},
+	{"-workers", "7", "-io", "mmap"},
+	{"-workers", "7", "-merge-strategy", "sharded"},
+}
+
+// runGolden processes every golden file in dir like the process subcommand would, in every variant, and compares the
+// output with the expected output byte for byte. With update the output of the first variant is written as the
+// expected output instead.
+func runGolden(dir string, update bool) error {
+	cases, err := goldenCases(dir, update)
+	if err != nil {
+		return err
+	}
+
+	// the logs of processing would drown the report
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	failed := 0
+	for _, c := range cases {
+		output, expected, err := c.run(update)
+		switch {
+		case err != nil:
+			return fmt.Errorf("%s: %w", c, err)
+		case update:
+			fmt.Println("updated", c.name+".out")
+		case !bytes.Equal(output, expected):
+			fmt.Printf("FAIL %s\n  expected %q\n  got      %q\n", c, expected, output)
+			failed++
+		default:
+			fmt.Printf("ok   %s\n", c)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d golden outputs differ", failed)
+	}
+	return nil
+}
+
+// goldenCase is a golden file processed in one of the variants
+type goldenCase struct {
+	path string   // the measurements, name.txt
+	name string   // path without the extension, name.out being the expected output
+	args []string // the flags of name.flags and of the variant
+}
+
+func (c goldenCase) String() string {
+	return c.path + " " + strings.Join(c.args, " ")
+}
+
+// goldenCases returns every golden file in dir in every variant, only in the first one with update
+func goldenCases(dir string, update bool) ([]goldenCase, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no golden files in %s", dir)
+	}
+
+	var cases []goldenCase
+	for _, path := range paths {
+		name := strings.TrimSuffix(path, ".txt")
+		extra, err := goldenFlags(name)
+		if err != nil {
+			return nil, err
+		}
+
+		variants := goldenVariants
+		if update {
+			variants = variants[:1]
+		}
+		for _, variant := range variants {
+			cases = append(cases, goldenCase{path, name, slices.Concat(extra, variant)})
+		}
+	}
+	return cases, nil
+}
+
+// run processes the golden file and returns its output with the expected output. With update the output is written
+// as the expected output instead.
+func (c goldenCase) run(update bool) (output []byte, expected []byte, err error) {
+	output, err = goldenOutput(c.path, c.args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if update {
+		return output, output, os.WriteFile(c.name+".out", output, 0o644)
+	}
+
+	expected, err = os.ReadFile(c.name + ".out")
+	if err != nil {
+		return nil, nil, err
+	}
+	return output, expected, nil
+}
+
+// goldenFlags returns the extra process flags of the golden file name.txt from name.flags, none without that file
+func goldenFlags(name string) ([]string, error) {
+	data, err := os.ReadFile(name + ".flags")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// goldenOutput processes the golden file at path with the process flags args and returns the output
+func goldenOutput(path string, args []string) ([]byte, error) {
+	output, err := os.CreateTemp("", "brc-golden-*")
+	if err != nil {
+		return nil, err
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	flags, err := parseProcessFlags(slices.Concat(args, []string{"-file", path, "-output", output.Name()}))
+	if err != nil {
+		return nil, err
+	}
+	err = processFiles(context.Background(), flags.Files, flags)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(output.Name())
+}
+
+// fuzzSeeds are the corner cases the generated readings start from
+var fuzzSeeds = []string{
+	"", "-", "+", ".", ",", "-.", "0", "-0", "00.0", "-0.0", "0.05", "1.", ".5", "-.5", "12.3", "-99.9", "99,9",
+	"1.2.3", "1..2", "--1", "+-1", "1-", "1e5", "1.5e-3", "inf", "NaN", "0x1p-2",
+	"12345678901234567890", "1234567890123456789012345.5", "0.000000000000000000000000001", "9007199254740993",
+	"999999999999999999.9", "-9223372036854775808", "17976931348623157e292",
+}
+
+// fuzzParsers compares every parser with strconv.ParseFloat on n readings, the seeds first and then random
+// mutations of them, and reports the readings they disagree on. The readings are the same on every run.
+func fuzzParsers(n int) error {
+	parsers := []struct {
+		name string
+		opts brc.Options
+	}{
+		{"fixed", brc.Options{}},
+		{"fixed with a decimal comma", brc.Options{DecimalComma: true}},
+		{"float", brc.Options{Parser: brc.ParseFloat}},
+		{"float with a decimal comma", brc.Options{Parser: brc.ParseFloat, DecimalComma: true}},
+		{"int", brc.Options{Parser: brc.ParseInt}},
+	}
+
+	r := rand.New(rand.NewPCG(1, 2))
+	mismatches := 0
+	for i := range n {
+		var reading []byte
+		if i < len(fuzzSeeds) {
+			reading = []byte(fuzzSeeds[i])
+		} else {
+			reading = mutateReading(r, []byte(fuzzSeeds[r.IntN(len(fuzzSeeds))]))
+		}
+
+		for _, p := range parsers {
+			err := brc.VerifyReading(reading, p.opts)
+			if err != nil {
+				mismatches++
+				if mismatches <= 20 {
+					fmt.Printf("%s: %v\n", p.name, err)
+				}
+			}
+		}
+	}
+
+	if mismatches > 0 {
+		return fmt.Errorf("the parsers disagree with strconv on %d readings", mismatches)
+	}
+	fmt.Println("all parsers agree with strconv on", n, "readings")
+	return nil
+}
+
+// mutateReading applies a few random edits to a copy of b, inserting, replacing or deleting characters of readings
+func mutateReading(r *rand.Rand, b []byte) []byte {
+	const chars = "0123456789.,-+e"
+	b = slices.Clone(b)
+	for range 1 + r.IntN(4) {
+		i := r.IntN(len(b) + 1)
+		c := chars[r.IntN(len(chars))]
+		switch op := r.IntN(3); {
+		case op == 0 || len(b) == 0:
+			b = slices.Insert(b, i, c)
+		case op == 1 && i < len(b):
+			b[i] = c
+		case i < len(b):
+			b = slices.Delete(b, i, i+1)
+		}
+	}
+	return b
+}
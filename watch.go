@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"beruzebabu/go_1brc/brc"
+)
+
+// watchDir processes every file created in dir until ctx is done, merging it into the cumulative results which are
+// written after every file. Files have to be complete when they appear, write them elsewhere and move them into dir.
+// Hidden files, like the temporary files of some tools, are ignored.
+func watchDir(ctx context.Context, dir string, flags CliFlags) error {
+	start := time.Now()
+
+	opts, closeBadLines, err := processOptions(flags)
+	if err != nil {
+		return err
+	}
+	defer closeBadLines()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("starting directory watch failed: %w", err)
+	}
+	defer watcher.Close()
+	err = watcher.Add(dir)
+	if err != nil {
+		return fmt.Errorf("watching %s failed: %w", dir, err)
+	}
+	log.Println("watching", dir, "for new files")
+
+	// the tables of every file processed are reported once watching stops
+	if opts.MapStats != nil {
+		defer reportMapStats(opts.MapStats)
+	}
+
+	var results brc.Results
+	// the checksum is of the cumulative results once watching stops
+	stopped := func() error {
+		if flags.Checksum {
+			return logChecksum(results, flags.ValueAsInt)
+		}
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("stopped watching", dir)
+			return stopped()
+		case err := <-watcher.Errors:
+			return fmt.Errorf("watching %s failed: %w", dir, err)
+		case event := <-watcher.Events:
+			if !event.Has(fsnotify.Create) || strings.HasPrefix(filepath.Base(event.Name), ".") {
+				continue
+			}
+
+			part, err := processWatchedFile(ctx, event.Name, flags.Compression, opts)
+			if ctx.Err() != nil {
+				log.Println("stopped watching", dir, "while processing", event.Name)
+				return stopped()
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", event.Name, err)
+			}
+			if part.Stations == nil {
+				continue // not a regular file
+			}
+
+			results.Merge(part)
+			log.Println("merged", event.Name, "into", len(results.Stations), "stations", time.Since(start))
+			err = writeSnapshot(results, flags, start)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// processWatchedFile aggregates a single file of the watched directory, directories are skipped with empty results
+func processWatchedFile(ctx context.Context, path string, compression string, opts brc.Options) (brc.Results, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return brc.Results{}, fmt.Errorf("opening file for reading failed: %w", err)
+	}
+	defer file.Close()
+	if !isRegular(file) {
+		return brc.Results{}, nil
+	}
+
+	input, err := decompress(file, compression)
+	if err != nil {
+		return brc.Results{}, err
+	}
+	if c, ok := input.(io.Closer); ok && input != io.Reader(file) {
+		defer c.Close()
+	}
+
+	return brc.ProcessInputsContext(ctx, []io.Reader{input}, opts)
+}